@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// askStopWords are too common in questions to say anything about which
+// files are relevant.
+var askStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "does": true, "how": true,
+	"what": true, "where": true, "which": true, "when": true, "why": true, "who": true,
+	"this": true, "that": true, "with": true, "from": true, "into": true, "there": true,
+	"can": true, "should": true, "would": true, "could": true, "will": true, "have": true,
+	"has": true, "use": true, "used": true, "uses": true, "project": true, "code": true,
+}
+
+// questionTerms splits a question into lower-case words worth searching for.
+func questionTerms(question string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(question), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, word := range words {
+		if len(word) < 3 || askStopWords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// rankFiles returns the files that mention any of terms, most relevant
+// first. A term in the path counts for more than one in the content, and
+// repeated mentions in the content are capped so one long file does not
+// outweigh everything else.
+func rankFiles(code map[string]string, terms []string) []string {
+	const pathWeight, maxMentions = 10, 20
+
+	scores := make(map[string]int)
+	for path, content := range code {
+		lowerPath, lowerContent := strings.ToLower(filepath.ToSlash(path)), strings.ToLower(content)
+		score := 0
+		for _, term := range terms {
+			if strings.Contains(lowerPath, term) {
+				score += pathWeight
+			}
+			score += min(strings.Count(lowerContent, term), maxMentions)
+		}
+		if score > 0 {
+			scores[path] = score
+		}
+	}
+
+	paths := sortedKeys(scores)
+	sort.SliceStable(paths, func(i, j int) bool { return scores[paths[i]] > scores[paths[j]] })
+	return paths
+}
+
+// ask answers a question about the repository from its project context, the
+// description from the last describe run and the files most relevant to the
+// question that fit in the token budget.
+func (p *pipeline) ask(ctx context.Context, dirPath, question string) (string, error) {
+	analysis, err := p.analyzeRepo(ctx, dirPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Symbols are left out; the relevant files are sent in full instead.
+	repoContext := analysis.projectContext("").Context
+	repoContext.Symbols = nil
+	contextJSON, err := p.modelContext(repoContext)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	description, err := os.ReadFile(filepath.Join(p.descriptionDir, "project_description.md"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read project description: %w", err)
+	}
+
+	data := promptData{
+		ProjectName:         analysis.projectName,
+		Question:            question,
+		Context:             string(contextJSON),
+		PreviousDescription: string(description),
+	}
+	remaining := p.tokenBudget - p.prompts.tokens(stageAsk, data)
+	if remaining <= 0 {
+		return "", errors.New("project context does not fit in the token budget; raise -token-budget or narrow the files with -include")
+	}
+
+	var blocks, used []string
+	for _, path := range rankFiles(analysis.code, questionTerms(question)) {
+		block := renderFile(path, analysis.code[path])
+		if tokens := estimateTokens(block); tokens <= remaining {
+			blocks = append(blocks, block)
+			used = append(used, path)
+			remaining -= tokens
+		}
+	}
+	data.Code = strings.Join(blocks, "")
+	progressf("Answering from %d relevant files\n", len(used))
+	debugf("Files sent: %s\n", strings.Join(used, ", "))
+
+	answer, err := complete(ctx, p.completer, p.prompts, stageAsk, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to call LLM: %w", err)
+	}
+	return answer, nil
+}
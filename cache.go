@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// promptVersion is part of every cache key. Bump it whenever a prompt
+// template changes so stale summaries are not reused.
+const promptVersion = "1"
+
+// cacheTTL is how long an entry survives without being used before it is
+// dropped on save, so caches of long-lived repositories do not grow forever.
+const cacheTTL = 30 * 24 * time.Hour
+
+type cacheEntry struct {
+	Content  string    `json:"content"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+type responseCache struct {
+	path string
+
+	mu      sync.Mutex
+	Version string                `json:"version"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+func loadCache(path string) (*responseCache, error) {
+	cache := &responseCache{path: path, Version: promptVersion, Entries: make(map[string]cacheEntry)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, err
+	}
+
+	var stored responseCache
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	if stored.Version == promptVersion && stored.Entries != nil {
+		cache.Entries = stored.Entries
+	}
+	return cache, nil
+}
+
+func (c *responseCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.Entries[key]
+	if !ok {
+		return "", false
+	}
+	entry.LastUsed = time.Now()
+	c.Entries[key] = entry
+	return entry.Content, true
+}
+
+func (c *responseCache) put(key, content string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries[key] = cacheEntry{Content: content, LastUsed: time.Now()}
+}
+
+// expired counts the entries the next save will drop.
+func (c *responseCache) expired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, entry := range c.Entries {
+		if time.Since(entry.LastUsed) > cacheTTL {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *responseCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.Entries {
+		if time.Since(entry.LastUsed) > cacheTTL {
+			delete(c.Entries, key)
+		}
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(c.path, data)
+}
+
+// cachedCompleter serves repeated requests from a responseCache. Prompts
+// embed the file contents or child summaries they describe, so hashing the
+// whole request is a content hash: unchanged files and directories produce
+// the same key and never reach the model again.
+type cachedCompleter struct {
+	next  Completer
+	cache *responseCache
+	model string
+
+	mu     sync.Mutex
+	hits   int
+	misses int
+}
+
+func newCachedCompleter(next Completer, cache *responseCache, model string) *cachedCompleter {
+	return &cachedCompleter{next: next, cache: cache, model: model}
+}
+
+func (c *cachedCompleter) key(req CompletionRequest) string {
+	h := sha256.New()
+	for _, part := range []string{promptVersion, c.model, req.System, req.Prompt, string(req.Schema)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *cachedCompleter) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	key := c.key(req)
+	if content, ok := c.cache.get(key); ok && (req.Validate == nil || req.Validate(content) == nil) {
+		c.count(true)
+		return Completion{Content: content}, nil
+	}
+	c.count(false)
+
+	resp, err := c.next.Complete(ctx, req)
+	if err != nil {
+		return Completion{}, err
+	}
+	if req.Validate == nil || req.Validate(resp.Content) == nil {
+		c.cache.put(key, resp.Content)
+	}
+	return resp, nil
+}
+
+func (c *cachedCompleter) count(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+}
+
+func (c *cachedCompleter) stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
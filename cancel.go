@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// errInterrupted and errTimedOut are the causes of a cancelled run.
+var (
+	errInterrupted = errors.New("interrupted")
+	errTimedOut    = errors.New("timed out")
+)
+
+// Exit statuses of a run stopped early. The first two are the same as a
+// shell's for SIGINT and timeout(1)'s.
+const (
+	exitInterrupted = 130
+	exitTimedOut    = 124
+	exitOverBudget  = 3
+)
+
+// interruptContext returns a context that is cancelled on SIGINT or SIGTERM.
+// Once it is, a second signal kills the program as usual, for when flushing
+// partial results takes too long.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			progressf("\nReceived %v; stopping and saving partial results (repeat to quit now)\n", sig)
+			cancel(errInterrupted)
+		case <-ctx.Done():
+			signal.Stop(signals)
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+// withTimeout limits ctx to the -timeout of the run, if there is one.
+func (c *Config) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, c.Timeout, fmt.Errorf("%w after %s", errTimedOut, c.Timeout))
+}
+
+// cancelled adds why ctx was cancelled to err, which otherwise only says
+// "context canceled" or blames whichever call happened to be running.
+func cancelled(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	cause := context.Cause(ctx)
+	if errors.Is(err, cause) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", cause, err)
+}
+
+// stopped reports whether err ended the run on purpose, because of a signal,
+// -timeout or the budget, rather than a failure, so that partial results are
+// worth keeping.
+func stopped(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, errOverBudget)
+}
+
+// exitStatus is the exit status for an error returned by run.
+func exitStatus(err error) int {
+	switch {
+	case errors.Is(err, errInterrupted):
+		return exitInterrupted
+	case errors.Is(err, errTimedOut):
+		return exitTimedOut
+	case errors.Is(err, errOverBudget):
+		return exitOverBudget
+	}
+	return 1
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// charsPerToken is the usual rule of thumb for English text and source code
+// with BPE tokenizers. It is deliberately conservative so estimates err on
+// the side of smaller prompts.
+const charsPerToken = 4
+
+func estimateTokens(s string) int {
+	return (len(s) + charsPerToken - 1) / charsPerToken
+}
+
+// capLines keeps lines while they fit in maxTokens together, then ends with
+// a line saying how many more were left out.
+func capLines(lines []string, maxTokens int, what string) []string {
+	used := 0
+	for i, line := range lines {
+		used += estimateTokens(line) + 1
+		if used > maxTokens {
+			return append(lines[:i:i], fmt.Sprintf("... %d more %s omitted", len(lines)-i, what))
+		}
+	}
+	return lines
+}
+
+func renderFile(path, content string) string {
+	return fmt.Sprintf("File: %s\n```\n%s\n```\n\n", path, content)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitText cuts text into pieces of at most maxTokens, preferring line
+// boundaries so code is not split mid-line when it can be avoided.
+func splitText(text string, maxTokens int) []string {
+	maxChars := maxTokens * charsPerToken
+	if maxChars <= 0 {
+		return []string{text}
+	}
+
+	var parts []string
+	for len(text) > maxChars {
+		cut := strings.LastIndex(text[:maxChars], "\n") + 1
+		if cut == 0 {
+			cut = maxChars
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		parts = append(parts, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" {
+		parts = append(parts, text)
+	}
+	return parts
+}
+
+// batchByBudget greedily groups items so that each group stays within budget
+// tokens. Items larger than the budget end up alone in their own group.
+func batchByBudget(items []string, budget int) [][]string {
+	var batches [][]string
+	var current []string
+	used := 0
+	for _, item := range items {
+		// Items are joined with a blank line, which counts too.
+		tokens := estimateTokens(item) + 1
+		if len(current) > 0 && used+tokens > budget {
+			batches = append(batches, current)
+			current, used = nil, 0
+		}
+		current = append(current, item)
+		used += tokens
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// pathRank orders the places a chunk may end. It depends on the path alone,
+// so it does not change when files do.
+func pathRank(path string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return h.Sum32()
+}
+
+// chunkCode renders the files in code and groups them into chunks that fit
+// in budget tokens, splitting any single file that is too large on its own.
+// Chunks are cached by their content, so their boundaries are kept stable:
+// a chunk ends after the file with the highest pathRank among those that
+// leave it between half and entirely full. Chunks that start at different
+// files mostly pick the same end, so a file that grows or is added only
+// changes the chunks around it rather than every later one.
+func chunkCode(code map[string]string, budget int) []string {
+	type block struct {
+		text   string
+		tokens int
+		// rank is set on the last block of a file, where a chunk may end.
+		rank    uint32
+		fileEnd bool
+	}
+	var blocks []block
+	for _, path := range sortedKeys(code) {
+		text := renderFile(path, code[path])
+		if estimateTokens(text) <= budget {
+			blocks = append(blocks, block{text, estimateTokens(text), pathRank(path), true})
+			continue
+		}
+		parts := splitText(code[path], budget-estimateTokens(renderFile(path+" (part 00/00)", "")))
+		for i, part := range parts {
+			text := renderFile(fmt.Sprintf("%s (part %d/%d)", path, i+1, len(parts)), part)
+			blocks = append(blocks, block{text, estimateTokens(text), pathRank(path), i == len(parts)-1})
+		}
+	}
+
+	var chunks []string
+	for start := 0; start < len(blocks); {
+		// Take everything that fits, noting the best place to end.
+		used, next, best := 0, start, -1
+		for next < len(blocks) && (next == start || used+blocks[next].tokens <= budget) {
+			used += blocks[next].tokens
+			if used >= budget/2 && blocks[next].fileEnd && (best < 0 || blocks[next].rank > blocks[best].rank) {
+				best = next
+			}
+			next++
+		}
+		if next < len(blocks) && best >= 0 {
+			next = best + 1
+		}
+		var b strings.Builder
+		for _, block := range blocks[start:next] {
+			b.WriteString(block.text)
+		}
+		chunks = append(chunks, b.String())
+		start = next
+	}
+	return chunks
+}
+
+// summarizeCode is the map-reduce path for repositories whose code does not
+// fit in a single prompt: every chunk of files is summarized on its own, then
+// the summaries are merged until they fit in target tokens together. Each
+// individual prompt stays within the token budget.
+func (p *pipeline) summarizeCode(ctx context.Context, projectName string, code map[string]string, target int) ([]string, error) {
+	data := func(chunk string) promptData { return promptData{ProjectName: projectName, Code: chunk} }
+	summaries, err := p.summarizeChunks(ctx, stageChunk, data, code)
+	if err != nil {
+		return nil, err
+	}
+	return p.mergeSummaries(ctx, projectName, summaries, target)
+}
+
+// summarizeChunks sends every chunk of code to the model as the prompt for
+// stage, with data supplying the template variables for each chunk. Chunks
+// are summarized concurrently; the summaries are in chunk order.
+func (p *pipeline) summarizeChunks(ctx context.Context, stage string, data func(chunk string) promptData, code map[string]string) ([]string, error) {
+	overhead := p.prompts.tokens(stage, data(""))
+	chunks := chunkCode(code, p.tokenBudget-overhead)
+
+	summaries := make([]string, len(chunks))
+	err := forEach(ctx, p.concurrency, len(chunks), func(ctx context.Context, i int) error {
+		progressf("Summarizing chunk %d/%d\n", i+1, len(chunks))
+		summary, err := complete(ctx, p.completer, p.prompts, stage, data(chunks[i]))
+		if err != nil {
+			return fmt.Errorf("summarizing chunk %d: %w", i+1, err)
+		}
+		summaries[i] = summary
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (p *pipeline) mergeSummaries(ctx context.Context, projectName string, summaries []string, target int) ([]string, error) {
+	overhead := p.prompts.tokens(stageMerge, promptData{ProjectName: projectName})
+	for estimateTokens(strings.Join(summaries, "\n\n")) > target {
+		batches := batchByBudget(summaries, p.tokenBudget-overhead)
+		if len(batches) == len(summaries) {
+			// Every summary already fills a prompt on its own, so merging
+			// cannot make progress.
+			break
+		}
+
+		merged := make([]string, len(batches))
+		err := forEach(ctx, p.concurrency, len(batches), func(ctx context.Context, i int) error {
+			progressf("Merging summaries %d/%d\n", i+1, len(batches))
+			summary, err := complete(ctx, p.completer, p.prompts, stageMerge, promptData{ProjectName: projectName, Summaries: strings.Join(batches[i], "\n\n")})
+			if err != nil {
+				return fmt.Errorf("merging summaries: %w", err)
+			}
+			merged[i] = summary
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		summaries = merged
+	}
+	return summaries, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxTokens int
+		want      []string
+	}{
+		{"fits", "a\nb\n", 10, []string{"a\nb\n"}},
+		{"empty", "", 10, nil},
+		{"no budget", "abc", 0, []string{"abc"}},
+		{"at lines", "aaaa\nbbbb\ncccc\n", 3, []string{"aaaa\nbbbb\n", "cccc\n"}},
+		{"long line", strings.Repeat("x", 10), 1, []string{"xxxx", "xxxx", "xx"}},
+		{"runes", "ééééé", 1, []string{"éé", "éé", "é"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(tt.text, tt.maxTokens)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("splitText = %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if !utf8.ValidString(part) {
+					t.Errorf("part %q is not valid UTF-8", part)
+				}
+			}
+		})
+	}
+}
+
+func testCode(files, lines int) map[string]string {
+	code := make(map[string]string)
+	for i := 0; i < files; i++ {
+		code[fmt.Sprintf("d%d/f%03d.go", i/10, i)] = strings.Repeat(fmt.Sprintf("line %d\n", i), lines+i%7*10)
+	}
+	return code
+}
+
+func TestChunkCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   map[string]string
+		budget int
+		chunks int
+	}{
+		{"fits in one", testCode(3, 5), 1000, 1},
+		{"many files", testCode(100, 20), 2000, 0},
+		{"large file", map[string]string{"big.txt": strings.Repeat("0123456789\n", 1000)}, 500, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkCode(tt.code, tt.budget)
+			if tt.chunks > 0 && len(chunks) != tt.chunks {
+				t.Errorf("got %d chunks, want %d", len(chunks), tt.chunks)
+			}
+			all := strings.Join(chunks, "")
+			for _, chunk := range chunks {
+				if tokens := estimateTokens(chunk); tokens > tt.budget {
+					t.Errorf("chunk of %d tokens is over the %d token budget", tokens, tt.budget)
+				}
+			}
+			for path := range tt.code {
+				if !strings.Contains(all, "File: "+path) {
+					t.Errorf("%s is in no chunk", path)
+				}
+			}
+		})
+	}
+}
+
+// TestChunkCodeFull checks that chunks are not cut short far below the
+// budget, which would multiply the model calls.
+func TestChunkCodeFull(t *testing.T) {
+	budget := 4000
+	chunks := chunkCode(testCode(500, 10), budget)
+	for _, chunk := range chunks[:len(chunks)-1] {
+		if tokens := estimateTokens(chunk); tokens < budget/2 {
+			t.Errorf("chunk of %d tokens is under half the %d token budget", tokens, budget)
+		}
+	}
+}
+
+// TestChunkCodeStable checks that growing one file leaves most chunks, and so
+// their cache entries, unchanged.
+func TestChunkCodeStable(t *testing.T) {
+	code := testCode(500, 10)
+	before := chunkCode(code, 4000)
+	code["d0/f003.go"] += strings.Repeat("more\n", 200)
+	after := chunkCode(code, 4000)
+
+	unchanged := make(map[string]bool)
+	for _, chunk := range before {
+		unchanged[chunk] = true
+	}
+	changed := 0
+	for _, chunk := range after {
+		if !unchanged[chunk] {
+			changed++
+		}
+	}
+	if changed > 2 {
+		t.Errorf("%d of %d chunks changed, want at most 2", changed, len(after))
+	}
+}
+
+func TestCapLines(t *testing.T) {
+	lines := []string{"aaaa", "bbbb", "cccc", "dddd"}
+	if got := capLines(lines, 100, "files"); len(got) != 4 {
+		t.Errorf("capLines under budget = %q, want all lines", got)
+	}
+	got := capLines(lines, 4, "files")
+	want := []string{"aaaa", "bbbb", "... 2 more files omitted"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("capLines = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,699 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// outputRoot holds one output directory per repository.
+const outputRoot = "data"
+
+type verbosityLevel int
+
+const (
+	quietLevel verbosityLevel = iota
+	normalLevel
+	verboseLevel
+)
+
+var verbosity = normalLevel
+
+// progressf reports progress unless -q is given. It writes to stderr so
+// that stdout carries only results, such as the answer from ask.
+func progressf(format string, args ...any) {
+	if verbosity >= normalLevel {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// debugf reports details, such as rendered prompts, with -v.
+func debugf(format string, args ...any) {
+	if verbosity >= verboseLevel {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+type command struct {
+	name    string
+	sub     string
+	args    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+// usageName is the command as typed, such as "cache clean".
+func (c command) usageName() string {
+	return strings.TrimSpace(c.name + " " + c.sub)
+}
+
+// commands is filled in by init because help refers back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"describe", "", "<directory>", "Describe a repository. This is the default command.", runDescribe},
+		{"context", "", "<directory>", "Write project_context.json and the dependency graph without calling the model.", runContext},
+		{"diff", "", "<base>..<head> [directory]", "Describe the changes in a range of git history.", runDiff},
+		{"ask", "", "<question> [directory]", "Answer a question about a repository.", runAsk},
+		{"cache", "clean", "[directory]", "Remove cached model responses.", runCache},
+		{"config", "show", "[directory]", "Print the effective configuration and where each value comes from.", runConfig},
+		{"providers", "list", "", "List the LLM providers.", runProviders},
+		{"version", "", "", "Print the version.", runVersion},
+		{"help", "", "[command]", "Show help for a command.", runHelp},
+	}
+}
+
+func progName() string {
+	return filepath.Base(os.Args[0])
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func usage(w io.Writer) {
+	name := progName()
+	fmt.Fprintf(w, "Usage: %s <command> [flags] [arguments]\n\nCommands:\n", name)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.usageName(), cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nA directory on its own is described, as with %s describe <directory>.\nRun %s help <command> for the flags of a command.\n", name, name)
+}
+
+// run dispatches to a command. Arguments that do not start with a command
+// name are a describe run, so older invocations keep working. Commands stop
+// on SIGINT or SIGTERM.
+func run(args []string) error {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "-h", "-help", "--help":
+		usage(os.Stdout)
+		return nil
+	case "-version", "--version":
+		return runVersion(context.Background(), nil)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	if cmd, ok := findCommand(args[0]); ok {
+		return cancelled(ctx, cmd.run(ctx, args[1:]))
+	}
+	return cancelled(ctx, runDescribe(ctx, args))
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	cmd, _ := findCommand(name)
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		line := strings.TrimSpace(fmt.Sprintf("%s %s [flags] %s", progName(), cmd.usageName(), cmd.args))
+		fmt.Fprintf(flags.Output(), "Usage: %s\n\n%s\n", line, cmd.summary)
+		hasFlags := false
+		flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(flags.Output(), "\nFlags:")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+// parseArgs parses flags wherever they appear among the arguments, unlike
+// flag.Parse, which stops at the first one that is not a flag, and returns
+// the rest.
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		// flags uses ExitOnError, so Parse does not return errors.
+		_ = flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// patternList is a repeatable flag of comma-separated patterns.
+type patternList []string
+
+func (l *patternList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *patternList) Set(s string) error {
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			*l = append(*l, pattern)
+		}
+	}
+	return nil
+}
+
+// optionalFloat is a flag for a value that is nil unless it is given.
+type optionalFloat struct {
+	p **float32
+}
+
+func (f optionalFloat) String() string {
+	if f.p == nil || *f.p == nil {
+		return ""
+	}
+	return strconv.FormatFloat(float64(**f.p), 'g', -1, 32)
+}
+
+func (f optionalFloat) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return errors.New("must not be negative")
+	}
+	value := float32(v)
+	*f.p = &value
+	return nil
+}
+
+// The flag registration functions bind flags to a Config holding the
+// defaults, so that -h shows them. The values that count are read back by
+// resolveConfig, which applies only the flags that were given on top of the
+// config files and environment.
+
+// repoFlags registers the flags of every command that reads a repository.
+func (c *Config) repoFlags(flags *flag.FlagSet) {
+	flags.StringVar(&c.OutputDir, "output-dir", c.OutputDir, "directory to write results to (default: "+filepath.Join(outputRoot, "<directory>")+")")
+	flags.Var((*patternList)(&c.Include), "include", "only read files matching this gitignore-style `pattern`; repeatable or comma-separated")
+	flags.Var((*patternList)(&c.Exclude), "exclude", "skip files matching this gitignore-style `pattern`; repeatable or comma-separated")
+	flags.StringVar(&c.RedactRules, "redact-rules", c.RedactRules, "JSON file of extra redaction rules (default: "+redactRulesFile+" in the repository)")
+	flags.Int64Var(&c.MaxFileSize, "max-file-size", c.MaxFileSize, "files larger than this many bytes are truncated; 0 disables the limit")
+	flags.StringVar(&c.Truncate, "truncate", c.Truncate, "how to handle files over -max-file-size: headtail, head or skip")
+	flags.BoolVar(&c.GoSource, "go-source", c.GoSource, "send raw Go source to the model in addition to the Go package analysis")
+	flags.DurationVar(&c.Timeout, "timeout", c.Timeout, "stop the run after this long, keeping partial results; 0 means no limit")
+	flags.BoolFunc("v", "verbose: also print rendered prompts and other details", func(string) error {
+		verbosity = verboseLevel
+		return nil
+	})
+	flags.BoolFunc("q", "quiet: print nothing but errors and results", func(string) error {
+		verbosity = quietLevel
+		return nil
+	})
+}
+
+// modelFlags registers the flags of every command that calls the model.
+func (c *Config) modelFlags(flags *flag.FlagSet) {
+	flags.StringVar(&c.Provider, "provider", c.Provider, "LLM provider: "+strings.Join(providerNames(), ", "))
+	flags.StringVar(&c.Model, "model", c.Model, "model name (defaults to the provider's default model)")
+	flags.StringVar(&c.BaseURL, "base-url", c.BaseURL, "API base URL for the provider")
+	flags.StringVar(&c.EnvFile, "env-file", c.EnvFile, "load variables from this file instead of searching for "+envFileName+" files")
+	flags.StringVar(&c.APIKeyFile, "api-key-file", c.APIKeyFile, "read the API key from this file")
+	flags.StringVar(&c.APIKeyCommand, "api-key-command", c.APIKeyCommand, "run this shell command and use its output as the API key")
+	flags.Var(optionalFloat{&c.Temperature}, "temperature", "sampling temperature, a `float` from 0 to 2 (defaults to the provider's)")
+	flags.IntVar(&c.TokenBudget, "token-budget", c.TokenBudget, "maximum estimated tokens per prompt; larger repositories are summarized in chunks")
+	flags.IntVar(&c.Concurrency, "concurrency", c.Concurrency, "maximum number of model calls in flight at once")
+	flags.IntVar(&c.MaxAttempts, "max-attempts", c.MaxAttempts, "attempts per model call before giving up on rate limiting, server and network errors")
+	flags.DurationVar(&c.RequestTimeout, "request-timeout", c.RequestTimeout, "timeout for each attempt at a model call; 0 disables it")
+	flags.IntVar(&c.RequestsPerMinute, "requests-per-minute", c.RequestsPerMinute, "maximum model calls per minute; 0 is unlimited")
+	flags.IntVar(&c.TokensPerMinute, "tokens-per-minute", c.TokensPerMinute, "maximum estimated prompt tokens sent per minute; 0 is unlimited")
+	flags.StringVar(&c.Prompts, "prompts", c.Prompts, "prompt set: a directory under "+promptSetsDir+" in the repository, a directory path, or a built-in set")
+	flags.BoolVar(&c.NoCache, "no-cache", c.NoCache, "ignore and do not update the response cache")
+	flags.BoolVar(&c.DryRun, "dry-run", c.DryRun, "write every prompt that would be sent, with token estimates and projected cost, under <output>/"+dryRunDir+" without calling the model")
+	flags.IntVar(&c.MaxTokens, "max-tokens", c.MaxTokens, "stop before the run uses more than this many prompt and completion tokens; 0 means no limit")
+	flags.Float64Var(&c.MaxCost, "max-cost", c.MaxCost, "stop before the run costs more than this many US dollars; 0 means no limit")
+	flags.Float64Var(&c.InputPrice, "input-price", c.InputPrice, "price in US dollars per million prompt tokens, for models missing from the pricing table")
+	flags.Float64Var(&c.OutputPrice, "output-price", c.OutputPrice, "price in US dollars per million completion tokens, for models missing from the pricing table")
+}
+
+// describeFlags registers the flags that only describe uses.
+func (c *Config) describeFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&c.Tree, "tree", c.Tree, "also write a summary for every directory under <output>/summaries and build the description from them")
+	outputType := strings.Join(c.OutputType, ",")
+	flags.StringVar(&outputType, "output-type", outputType, "comma-separated documents to write: "+strings.Join(outputTypeNames(), ", "))
+}
+
+// loadConfig resolves and checks the configuration for dirPath.
+func loadConfig(dirPath string, flags *flag.FlagSet) (*Config, error) {
+	cfg, err := resolveConfigWithEnv(dirPath, flags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func flagGiven(flags *flag.FlagSet, name string) bool {
+	given := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
+func defaultOutputDir(dirPath string) string {
+	return filepath.Join(outputRoot, safeFileName(dirPath))
+}
+
+// pipeline sets up a pipeline for the repository at dirPath. With withModel
+// it also creates the completer; finish then saves the response cache and
+// the usage report, and must be called even when the run fails so the next
+// attempt does not pay for the same calls again.
+func (c *Config) pipeline(dirPath string, withModel bool) (p *pipeline, finish func(), err error) {
+	outputDir := c.OutputDir
+	if outputDir == "" {
+		outputDir = defaultOutputDir(dirPath)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create directories: %w", err)
+	}
+
+	redactRules, err := loadRedactRules(dirPath, c.RedactRules)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load redaction rules: %w", err)
+	}
+
+	outputs, err := parseOutputTypes(strings.Join(c.OutputType, ","))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p = &pipeline{
+		outputDir:      outputDir,
+		descriptionDir: outputDir,
+		tokenBudget:    c.TokenBudget,
+		tree:           c.Tree,
+		redactRules:    redactRules,
+		limits:         fileLimits{maxSize: c.MaxFileSize, truncate: c.Truncate},
+		include:        c.Include,
+		exclude:        c.Exclude,
+		goSource:       c.GoSource,
+		concurrency:    c.Concurrency,
+		outputs:        outputs,
+	}
+	finish = func() {}
+	if !withModel {
+		return p, finish, nil
+	}
+
+	providerConfig := ProviderConfig{
+		Name:          c.Provider,
+		Model:         c.Model,
+		BaseURL:       c.BaseURL,
+		APIKeyFile:    c.APIKeyFile,
+		APIKeyCommand: c.APIKeyCommand,
+		Temperature:   c.Temperature,
+	}.withDefaults()
+	price, priced := lookupPrice(providerConfig.Name, providerConfig.Model)
+	if c.InputPrice > 0 || c.OutputPrice > 0 {
+		price, priced = modelPrice{Input: c.InputPrice, Output: c.OutputPrice}, true
+	}
+	budget := usageBudget{maxTokens: c.MaxTokens, maxCost: c.MaxCost}
+	if c.DryRun {
+		p.outputDir = filepath.Join(outputDir, dryRunDir)
+		dryRun, err := newDryRunCompleter(filepath.Join(p.outputDir, "prompts"), providerConfig, price, priced)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create directories: %w", err)
+		}
+		p.completer = dryRun
+		progressf("Dry run: nothing is sent; prompts are written to %s\n", dryRun.dir)
+		// Nothing is gained from concurrency without network calls, and
+		// serially the prompts are numbered the same way every time.
+		p.concurrency = 1
+		// The point of a dry run is to see everything a real one would send.
+		budget = usageBudget{}
+	} else {
+		if c.MaxCost > 0 && !priced {
+			return nil, nil, fmt.Errorf("no price is known for %s; set input_price and output_price to use max_cost", providerConfig.Model)
+		}
+		completer, err := newCompleter(providerConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create provider: %w", err)
+		}
+		p.completer = newRetryingCompleter(completer, retryPolicy{
+			maxAttempts:       c.MaxAttempts,
+			timeout:           c.RequestTimeout,
+			requestsPerMinute: c.RequestsPerMinute,
+			tokensPerMinute:   c.TokensPerMinute,
+			concurrency:       c.Concurrency,
+		})
+	}
+
+	meter := newMeteredCompleter(p.completer, providerConfig, price, priced, budget)
+	meter.dryRun = c.DryRun
+	p.completer = meter
+	reportUsage := func() {
+		report := meter.report()
+		path, err := writeUsageReport(p.outputDir, report)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		progressf("%s; report written to %s\n", report.summary(), path)
+	}
+	finish = reportUsage
+
+	p.prompts, err = loadPromptSet(dirPath, c.Prompts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load prompts: %w", err)
+	}
+
+	if !c.NoCache {
+		cache, err := loadCache(filepath.Join(outputDir, "cache.json"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load cache: %w", err)
+		}
+		cached := newCachedCompleter(p.completer, cache, providerConfig.cacheModel())
+		p.completer = cached
+		finish = func() {
+			// A dry run reads the cache, so prompts with a cached reply
+			// are known not to be sent, but must not fill it with
+			// placeholders.
+			if !c.DryRun {
+				if err := cache.save(); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to save cache: %v\n", err)
+				}
+			}
+			hits, misses := cached.stats()
+			progressf("Cache: %d hits, %d misses\n", hits, misses)
+			reportUsage()
+		}
+	}
+	return p, finish, nil
+}
+
+func runDescribe(ctx context.Context, args []string) error {
+	flags := newFlagSet("describe")
+	defaults := defaultConfig()
+	defaults.repoFlags(flags)
+	defaults.modelFlags(flags)
+	defaults.describeFlags(flags)
+	format := flags.String("format", "markdown", "format of the description: markdown, or json for the structured description")
+	args = parseArgs(flags, args)
+
+	if len(args) > 0 && args[0] == "diff" {
+		return fmt.Errorf("flags now go after the command: %s diff [flags] <base>..<head> [directory]", progName())
+	}
+	if len(args) != 1 {
+		flags.Usage()
+		return errors.New("please provide one directory path")
+	}
+	dirPath := args[0]
+
+	cfg, err := loadConfig(dirPath, flags)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "markdown", "md":
+	case "json":
+		if flagGiven(flags, "output-type") {
+			return errors.New("-format json writes the structured description and cannot be combined with -output-type")
+		}
+		cfg.OutputType = []string{"json"}
+	default:
+		return fmt.Errorf("unknown format %q; choose markdown or json", *format)
+	}
+
+	p, finish, err := cfg.pipeline(dirPath, true)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := cfg.withTimeout(ctx)
+	defer cancel()
+	err = p.describeRepo(ctx, dirPath)
+	finish()
+	return cancelled(ctx, err)
+}
+
+func runContext(ctx context.Context, args []string) error {
+	flags := newFlagSet("context")
+	defaultConfig().repoFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		flags.Usage()
+		return errors.New("please provide one directory path")
+	}
+
+	cfg, err := loadConfig(args[0], flags)
+	if err != nil {
+		return err
+	}
+	p, _, err := cfg.pipeline(args[0], false)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := cfg.withTimeout(ctx)
+	defer cancel()
+	return cancelled(ctx, p.buildContext(ctx, args[0]))
+}
+
+func runDiff(ctx context.Context, args []string) error {
+	flags := newFlagSet("diff")
+	defaults := defaultConfig()
+	defaults.repoFlags(flags)
+	defaults.modelFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) == 0 || len(args) > 2 {
+		flags.Usage()
+		return errors.New("please provide a revision range, e.g. main..HEAD")
+	}
+	revRange, dirPath := args[0], "."
+	if len(args) == 2 {
+		dirPath = args[1]
+	}
+
+	cfg, err := loadConfig(dirPath, flags)
+	if err != nil {
+		return err
+	}
+	p, finish, err := cfg.pipeline(dirPath, true)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := cfg.withTimeout(ctx)
+	defer cancel()
+	err = p.describeDiff(ctx, dirPath, revRange)
+	finish()
+	return cancelled(ctx, err)
+}
+
+func runAsk(ctx context.Context, args []string) error {
+	flags := newFlagSet("ask")
+	defaults := defaultConfig()
+	defaults.repoFlags(flags)
+	defaults.modelFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) == 0 || len(args) > 2 {
+		flags.Usage()
+		return errors.New("please provide a question")
+	}
+	question, dirPath := args[0], "."
+	if len(args) == 2 {
+		dirPath = args[1]
+	}
+
+	cfg, err := loadConfig(dirPath, flags)
+	if err != nil {
+		return err
+	}
+	p, finish, err := cfg.pipeline(dirPath, true)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := cfg.withTimeout(ctx)
+	defer cancel()
+	answer, err := p.ask(ctx, dirPath, question)
+	finish()
+	if err != nil {
+		return cancelled(ctx, err)
+	}
+	if cfg.DryRun {
+		return nil
+	}
+	fmt.Println(answer)
+	return nil
+}
+
+func runConfig(ctx context.Context, args []string) error {
+	flags := newFlagSet("config")
+	defaults := defaultConfig()
+	defaults.repoFlags(flags)
+	defaults.modelFlags(flags)
+	defaults.describeFlags(flags)
+	if len(args) > 0 && args[0] == "show" {
+		args = args[1:]
+	} else if len(args) == 0 || !strings.HasPrefix(args[0], "-") {
+		flags.Usage()
+		return errors.New("unknown config command; the only one is show")
+	}
+	args = parseArgs(flags, args)
+	if len(args) > 1 {
+		flags.Usage()
+		return errors.New("please provide at most one directory path")
+	}
+	dirPath := "."
+	if len(args) == 1 {
+		dirPath = args[0]
+	}
+
+	cfg, err := resolveConfigWithEnv(dirPath, flags)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := cfg.write(os.Stdout); err != nil {
+		return err
+	}
+	// Show the configuration even when it is invalid, then say why.
+	return cfg.validate()
+}
+
+func runCache(ctx context.Context, args []string) error {
+	flags := newFlagSet("cache")
+	outputDir := flags.String("output-dir", "", "output directory whose cache to clean (default: "+filepath.Join(outputRoot, "<directory>")+")")
+	all := flags.Bool("all", false, "clean the cache of every repository under "+outputRoot)
+	expired := flags.Bool("expired", false, fmt.Sprintf("only drop entries unused for %d days", cacheTTL/(24*time.Hour)))
+	quiet := flags.Bool("q", false, "quiet: print nothing but errors")
+	if len(args) > 0 && args[0] == "clean" {
+		args = args[1:]
+	} else if len(args) == 0 || !strings.HasPrefix(args[0], "-") {
+		flags.Usage()
+		return errors.New("unknown cache command; the only one is clean")
+	}
+	args = parseArgs(flags, args)
+	if *quiet {
+		verbosity = quietLevel
+	}
+
+	var paths []string
+	switch {
+	case *all:
+		err := filepath.WalkDir(outputRoot, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && d.Name() == "cache.json" {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to find caches: %w", err)
+		}
+	case *outputDir != "":
+		paths = []string{filepath.Join(*outputDir, "cache.json")}
+	case len(args) == 1:
+		paths = []string{filepath.Join(defaultOutputDir(args[0]), "cache.json")}
+	default:
+		flags.Usage()
+		return errors.New("please provide a directory path, -output-dir or -all")
+	}
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			progressf("No cache at %s\n", path)
+			continue
+		}
+		if !*expired {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove cache: %w", err)
+			}
+			progressf("Removed %s\n", path)
+			continue
+		}
+		cache, err := loadCache(path)
+		if err != nil {
+			return fmt.Errorf("failed to load cache: %w", err)
+		}
+		dropped := cache.expired()
+		if err := cache.save(); err != nil {
+			return fmt.Errorf("failed to save cache: %w", err)
+		}
+		progressf("Dropped %d expired entries from %s\n", dropped, path)
+	}
+	return nil
+}
+
+func runProviders(ctx context.Context, args []string) error {
+	flags := newFlagSet("providers")
+	if len(args) > 0 && args[0] == "list" {
+		args = args[1:]
+	} else if len(args) == 0 || !strings.HasPrefix(args[0], "-") {
+		flags.Usage()
+		return errors.New("unknown providers command; the only one is list")
+	}
+	parseArgs(flags, args)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDEFAULT MODEL\tAPI KEY\tDESCRIPTION")
+	for _, name := range providerNames() {
+		p := providers[name]
+		label, keyEnv := name, p.keyEnv
+		if name == defaultProvider {
+			label += " (default)"
+		}
+		if keyEnv == "" {
+			keyEnv = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", label, p.defaultModel, keyEnv, p.description)
+	}
+	return tw.Flush()
+}
+
+func versionString() string {
+	v := version
+	if v == "dev" {
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+	}
+	return v
+}
+
+func runVersion(ctx context.Context, args []string) error {
+	flags := newFlagSet("version")
+	parseArgs(flags, args)
+	fmt.Printf("%s %s (%s)\n", progName(), versionString(), runtime.Version())
+	return nil
+}
+
+func runHelp(ctx context.Context, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		usage(os.Stdout)
+		return nil
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		usage(os.Stderr)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	// Every command prints its usage and exits on -h.
+	return cmd.run(ctx, []string{"-h"})
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the effective configuration of a run. It is built up in layers,
+// each overriding the keys it sets in the ones before: built-in defaults,
+// the user config, the repository config, DESCRIBE_* environment variables
+// and finally the flags given on the command line.
+//
+// Keys are the flag names with dashes replaced by underscores.
+type Config struct {
+	Provider          string        `yaml:"provider" toml:"provider"`
+	Model             string        `yaml:"model" toml:"model"`
+	BaseURL           string        `yaml:"base_url" toml:"base_url"`
+	EnvFile           string        `yaml:"env_file" toml:"env_file"`
+	APIKeyFile        string        `yaml:"api_key_file" toml:"api_key_file"`
+	APIKeyCommand     string        `yaml:"api_key_command" toml:"api_key_command"`
+	Temperature       *float32      `yaml:"temperature" toml:"temperature"`
+	Prompts           string        `yaml:"prompts" toml:"prompts"`
+	TokenBudget       int           `yaml:"token_budget" toml:"token_budget"`
+	Concurrency       int           `yaml:"concurrency" toml:"concurrency"`
+	MaxAttempts       int           `yaml:"max_attempts" toml:"max_attempts"`
+	RequestTimeout    time.Duration `yaml:"request_timeout" toml:"request_timeout"`
+	RequestsPerMinute int           `yaml:"requests_per_minute" toml:"requests_per_minute"`
+	TokensPerMinute   int           `yaml:"tokens_per_minute" toml:"tokens_per_minute"`
+	MaxTokens         int           `yaml:"max_tokens" toml:"max_tokens"`
+	MaxCost           float64       `yaml:"max_cost" toml:"max_cost"`
+	InputPrice        float64       `yaml:"input_price" toml:"input_price"`
+	OutputPrice       float64       `yaml:"output_price" toml:"output_price"`
+	MaxFileSize       int64         `yaml:"max_file_size" toml:"max_file_size"`
+	Truncate          string        `yaml:"truncate" toml:"truncate"`
+	Include           []string      `yaml:"include" toml:"include"`
+	Exclude           []string      `yaml:"exclude" toml:"exclude"`
+	RedactRules       string        `yaml:"redact_rules" toml:"redact_rules"`
+	GoSource          bool          `yaml:"go_source" toml:"go_source"`
+	OutputType        []string      `yaml:"output_type" toml:"output_type"`
+	OutputDir         string        `yaml:"output_dir" toml:"output_dir"`
+	Tree              bool          `yaml:"tree" toml:"tree"`
+	NoCache           bool          `yaml:"no_cache" toml:"no_cache"`
+	DryRun            bool          `yaml:"dry_run" toml:"dry_run"`
+	Timeout           time.Duration `yaml:"timeout" toml:"timeout"`
+
+	// sources records which layer each key came from, for config show.
+	sources map[string]string
+	// layers lists the configuration files and other layers that were read.
+	layers []string
+	// envFiles are the .env files that were loaded.
+	envFiles []string
+}
+
+const (
+	configDirName   = "go-describe-repo"
+	configEnvPrefix = "DESCRIBE_"
+)
+
+// repoConfigFiles and userConfigFiles are tried in order; the first that
+// exists is used.
+var (
+	repoConfigFiles = []string{".describe.yaml", ".describe.yml", ".describe.toml"}
+	userConfigFiles = []string{"config.yaml", "config.yml", "config.toml"}
+)
+
+// repoConfigForbidden are keys a repository config may not set: a cloned
+// repository could otherwise send the user's API key to a server of its
+// choosing, run commands, or lift the spending limits of the user's config.
+var repoConfigForbidden = []string{
+	"base_url", "env_file", "api_key_file", "api_key_command",
+	"max_tokens", "max_cost", "input_price", "output_price",
+}
+
+func defaultConfig() *Config {
+	cfg := &Config{
+		Provider:       defaultProvider,
+		Prompts:        defaultPromptSet,
+		TokenBudget:    16000,
+		Concurrency:    defaultConcurrency,
+		MaxAttempts:    5,
+		RequestTimeout: 5 * time.Minute,
+		MaxFileSize:    100 * 1024,
+		Truncate:       truncateHeadTail,
+		OutputType:     []string{defaultOutputType},
+		sources:        make(map[string]string),
+		layers:         []string{"defaults"},
+	}
+	for _, key := range configKeys() {
+		cfg.sources[key] = "default"
+	}
+	return cfg
+}
+
+// configKeys returns the keys in the order they are declared.
+func configKeys() []string {
+	var keys []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("yaml"); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (c *Config) field(key string) (reflect.Value, bool) {
+	t := reflect.TypeOf(*c)
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("yaml") == key {
+			return reflect.ValueOf(c).Elem().Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// set parses value, as given in an environment variable or flag, into key.
+// Lists are comma-separated.
+func (c *Config) set(key, value, source string) error {
+	v, ok := c.field(key)
+	if !ok {
+		return fmt.Errorf("unknown configuration key %q", key)
+	}
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	case v.Kind() == reflect.Pointer:
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return err
+		}
+		f32 := float32(f)
+		v.Set(reflect.ValueOf(&f32))
+	}
+	c.sources[key] = source
+	return nil
+}
+
+// loadFile applies a YAML or TOML configuration file. Relative paths in a
+// repository config are relative to the repository, and its output_dir must
+// stay inside it, so that a cloned repository cannot have files written
+// anywhere else.
+func (c *Config) loadFile(file, repoPath string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	// Decoding into a map first finds the keys the file sets, so unknown
+	// keys are reported and only the keys present override earlier layers.
+	var keys map[string]any
+	unmarshal := yaml.Unmarshal
+	if filepath.Ext(file) == ".toml" {
+		unmarshal = toml.Unmarshal
+	}
+	if err := unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for key := range keys {
+		if _, ok := c.field(key); !ok {
+			return fmt.Errorf("%s: unknown configuration key %q", file, key)
+		}
+		if repoPath != "" && slices.Contains(repoConfigForbidden, key) {
+			return fmt.Errorf("%s: %s can only be set in the user config, the environment or a flag", file, key)
+		}
+	}
+	if err := unmarshal(data, c); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	for key := range keys {
+		c.sources[key] = file
+	}
+	if repoPath != "" {
+		for key, path := range map[string]*string{"redact_rules": &c.RedactRules, "output_dir": &c.OutputDir} {
+			if _, set := keys[key]; set && *path != "" && !filepath.IsAbs(*path) {
+				*path = filepath.Join(repoPath, *path)
+			}
+		}
+		if _, set := keys["output_dir"]; set && c.OutputDir != "" && !withinDir(repoPath, c.OutputDir) {
+			return fmt.Errorf("%s: output_dir %s is outside the repository", file, c.OutputDir)
+		}
+	}
+	c.layers = append(c.layers, file)
+	return nil
+}
+
+// withinDir reports whether path is dir or inside it, once symbolic links
+// in the part of path that exists are followed.
+func withinDir(dir, path string) bool {
+	dir, err := resolvePath(dir)
+	if err != nil {
+		return false
+	}
+	path, err = resolvePath(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath makes path absolute and follows the symbolic links in its
+// longest existing prefix; the rest need not exist yet.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path, nil
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// findConfigFile returns the first of names that exists in dir, or "".
+func findConfigFile(dir string, names []string) string {
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file
+		}
+	}
+	return ""
+}
+
+// userConfigDir is where the user config lives, or "" if the platform has
+// no such directory.
+func userConfigDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, configDirName)
+}
+
+// resolveConfig builds the configuration for the repository at repoPath,
+// applying the flags set on flags last.
+func resolveConfig(repoPath string, flags *flag.FlagSet) (*Config, error) {
+	cfg := defaultConfig()
+
+	if dir := userConfigDir(); dir != "" {
+		if file := findConfigFile(dir, userConfigFiles); file != "" {
+			if err := cfg.loadFile(file, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if file := findConfigFile(repoPath, repoConfigFiles); file != "" {
+		if err := cfg.loadFile(file, repoPath); err != nil {
+			return nil, err
+		}
+	}
+
+	usedEnv := false
+	for _, key := range configKeys() {
+		name := configEnvPrefix + strings.ToUpper(key)
+		if value, ok := os.LookupEnv(name); ok {
+			if err := cfg.set(key, value, "$"+name); err != nil {
+				return nil, fmt.Errorf("$%s: %w", name, err)
+			}
+			usedEnv = true
+		}
+	}
+	if usedEnv {
+		cfg.layers = append(cfg.layers, "environment ("+configEnvPrefix+"*)")
+	}
+
+	var flagErr error
+	usedFlags := false
+	flags.Visit(func(f *flag.Flag) {
+		key := strings.ReplaceAll(f.Name, "-", "_")
+		if _, ok := cfg.field(key); !ok || flagErr != nil {
+			return
+		}
+		if err := cfg.set(key, f.Value.String(), "-"+f.Name); err != nil {
+			flagErr = fmt.Errorf("-%s: %w", f.Name, err)
+		}
+		usedFlags = true
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+	if usedFlags {
+		cfg.layers = append(cfg.layers, "flags")
+	}
+	return cfg, nil
+}
+
+// write prints the configuration as YAML, which can be used as a config
+// file, with the source of every key as a comment.
+func (c *Config) write(w io.Writer) error {
+	fmt.Fprintln(w, "# Layers, from lowest to highest precedence:")
+	for _, layer := range c.layers {
+		fmt.Fprintf(w, "#   %s\n", layer)
+	}
+	if len(c.envFiles) > 0 {
+		fmt.Fprintf(w, "# Loaded %s\n", strings.Join(c.envFiles, ", "))
+	}
+	for _, key := range configKeys() {
+		v, _ := c.field(key)
+		// JSON is valid YAML flow syntax and keeps every value on one line.
+		value, err := json.Marshal(v.Interface())
+		if d, ok := v.Interface().(time.Duration); ok {
+			value, err = json.Marshal(d.String())
+		}
+		if err != nil {
+			return err
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			value = []byte("[]")
+		}
+		fmt.Fprintf(w, "%s: %s # %s\n", key, value, c.sources[key])
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	if !validTruncateStrategy(c.Truncate) {
+		return fmt.Errorf("unknown truncation strategy %q", c.Truncate)
+	}
+	if c.TokenBudget < minTokenBudget {
+		return fmt.Errorf("token budget must be at least %d", minTokenBudget)
+	}
+	if c.Concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+	if c.MaxAttempts < 1 {
+		return errors.New("max attempts must be at least 1")
+	}
+	if c.Timeout < 0 || c.RequestTimeout < 0 || c.RequestsPerMinute < 0 || c.TokensPerMinute < 0 {
+		return errors.New("timeouts and rate limits must not be negative")
+	}
+	if c.MaxTokens < 0 || c.MaxCost < 0 || c.InputPrice < 0 || c.OutputPrice < 0 {
+		return errors.New("budgets and prices must not be negative")
+	}
+	if c.Temperature != nil && *c.Temperature < 0 {
+		return errors.New("temperature must not be negative")
+	}
+	if _, err := parseOutputTypes(strings.Join(c.OutputType, ",")); err != nil {
+		return err
+	}
+	return nil
+}
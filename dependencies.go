@@ -0,0 +1,599 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/mod/modfile"
+)
+
+// Dependency scopes. Runtime dependencies are the ones shipped with the
+// project; the others are only needed to develop, test or build it.
+const (
+	scopeRuntime  = "runtime"
+	scopeDev      = "dev"
+	scopeTest     = "test"
+	scopeBuild    = "build"
+	scopeOptional = "optional"
+)
+
+type Dependency struct {
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	Ecosystem string `json:"ecosystem"`
+	Manifest  string `json:"manifest"`
+	Scope     string `json:"scope"`
+	Category  string `json:"category,omitempty"`
+}
+
+// dependencyCategories maps well-known libraries to what they are used for.
+// Go modules are listed without their major version suffix and Maven
+// artifacts as group:artifact or just the group.
+var dependencyCategories = map[string]string{
+	// Web frameworks.
+	"github.com/gin-gonic/gin":          "web framework",
+	"github.com/labstack/echo":          "web framework",
+	"github.com/gofiber/fiber":          "web framework",
+	"github.com/go-chi/chi":             "web framework",
+	"github.com/gorilla/mux":            "web framework",
+	"express":                           "web framework",
+	"fastify":                           "web framework",
+	"koa":                               "web framework",
+	"@nestjs/core":                      "web framework",
+	"next":                              "web framework",
+	"react":                             "UI framework",
+	"vue":                               "UI framework",
+	"svelte":                            "UI framework",
+	"@angular/core":                     "UI framework",
+	"django":                            "web framework",
+	"flask":                             "web framework",
+	"fastapi":                           "web framework",
+	"starlette":                         "web framework",
+	"tornado":                           "web framework",
+	"actix-web":                         "web framework",
+	"axum":                              "web framework",
+	"rocket":                            "web framework",
+	"warp":                              "web framework",
+	"rails":                             "web framework",
+	"sinatra":                           "web framework",
+	"org.springframework.boot":          "web framework",
+	"io.quarkus":                        "web framework",
+	"io.micronaut":                      "web framework",
+	"io.javalin:javalin":                "web framework",
+	"org.springframework:spring-webmvc": "web framework",
+
+	// Database drivers and ORMs.
+	"github.com/lib/pq":              "database driver",
+	"github.com/jackc/pgx":           "database driver",
+	"github.com/go-sql-driver/mysql": "database driver",
+	"github.com/mattn/go-sqlite3":    "database driver",
+	"modernc.org/sqlite":             "database driver",
+	"go.mongodb.org/mongo-driver":    "database driver",
+	"github.com/redis/go-redis":      "database driver",
+	"gorm.io/gorm":                   "ORM",
+	"github.com/jmoiron/sqlx":        "database driver",
+	"pg":                             "database driver",
+	"mysql2":                         "database driver",
+	"mongodb":                        "database driver",
+	"mongoose":                       "ORM",
+	"redis":                          "database driver",
+	"ioredis":                        "database driver",
+	"better-sqlite3":                 "database driver",
+	"prisma":                         "ORM",
+	"@prisma/client":                 "ORM",
+	"typeorm":                        "ORM",
+	"sequelize":                      "ORM",
+	"knex":                           "database driver",
+	"psycopg2":                       "database driver",
+	"psycopg2-binary":                "database driver",
+	"psycopg":                        "database driver",
+	"asyncpg":                        "database driver",
+	"pymysql":                        "database driver",
+	"pymongo":                        "database driver",
+	"sqlalchemy":                     "ORM",
+	"peewee":                         "ORM",
+	"diesel":                         "ORM",
+	"sqlx":                           "database driver",
+	"rusqlite":                       "database driver",
+	"tokio-postgres":                 "database driver",
+	"sea-orm":                        "ORM",
+	"sqlite3":                        "database driver",
+	"activerecord":                   "ORM",
+	"org.postgresql:postgresql":      "database driver",
+	"mysql:mysql-connector-java":     "database driver",
+	"com.mysql:mysql-connector-j":    "database driver",
+	"org.xerial:sqlite-jdbc":         "database driver",
+	"org.hibernate":                  "ORM",
+	"org.hibernate.orm":              "ORM",
+	"org.mongodb":                    "database driver",
+	"org.springframework.data":       "ORM",
+
+	// Command line libraries.
+	"github.com/spf13/cobra":     "CLI library",
+	"github.com/spf13/pflag":     "CLI library",
+	"github.com/urfave/cli":      "CLI library",
+	"github.com/alecthomas/kong": "CLI library",
+	"commander":                  "CLI library",
+	"yargs":                      "CLI library",
+	"click":                      "CLI library",
+	"typer":                      "CLI library",
+	"clap":                       "CLI library",
+	"structopt":                  "CLI library",
+	"thor":                       "CLI library",
+	"info.picocli:picocli":       "CLI library",
+
+	// Testing.
+	"github.com/stretchr/testify": "test library",
+	"github.com/onsi/ginkgo":      "test library",
+	"github.com/onsi/gomega":      "test library",
+	"github.com/google/go-cmp":    "test library",
+	"jest":                        "test library",
+	"mocha":                       "test library",
+	"chai":                        "test library",
+	"vitest":                      "test library",
+	"@testing-library/react":      "test library",
+	"cypress":                     "test library",
+	"playwright":                  "test library",
+	"@playwright/test":            "test library",
+	"pytest":                      "test library",
+	"pytest-cov":                  "test library",
+	"hypothesis":                  "test library",
+	"nose":                        "test library",
+	"tox":                         "test library",
+	"mockall":                     "test library",
+	"proptest":                    "test library",
+	"criterion":                   "test library",
+	"rspec":                       "test library",
+	"rspec-rails":                 "test library",
+	"minitest":                    "test library",
+	"capybara":                    "test library",
+	"junit:junit":                 "test library",
+	"org.junit.jupiter":           "test library",
+	"org.mockito":                 "test library",
+	"org.assertj":                 "test library",
+	"org.testng:testng":           "test library",
+}
+
+var (
+	pep508Requirement = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[[^\]]*\])?\s*(.*)$`)
+	gemfileGem        = regexp.MustCompile(`^gem\s+["']([^"']+)["'](?:\s*,\s*["']([^"']+)["'](?:\s*,\s*["']([^"']+)["'])?)?`)
+	gemfileGroup      = regexp.MustCompile(`^group\s+(.+?)\s+do\b`)
+	gemfileInlineGrp  = regexp.MustCompile(`group:\s*(?:\[([^\]]*)\]|:(\w+))`)
+	goMajorSuffix     = regexp.MustCompile(`/v[0-9]+$`)
+	pomProperty       = regexp.MustCompile(`\$\{([^}]+)\}`)
+)
+
+// parseDependencies reads the direct dependencies declared in every
+// dependency manifest in code. Vendored copies of other projects'
+// manifests are left out.
+func parseDependencies(code map[string]string) []Dependency {
+	var deps []Dependency
+	for _, file := range sortedKeys(code) {
+		slashed := filepath.ToSlash(file)
+		if vendoredPath.MatchString(slashed) {
+			continue
+		}
+		content := code[file]
+		switch name := path.Base(slashed); {
+		case name == "go.mod":
+			deps = append(deps, goModDependencies(slashed, content)...)
+		case name == "package.json":
+			deps = append(deps, packageJSONDependencies(slashed, content)...)
+		case name == "requirements.txt" || strings.HasPrefix(name, "requirements") && strings.HasSuffix(name, ".txt"):
+			deps = append(deps, requirementsDependencies(slashed, content)...)
+		case name == "pyproject.toml":
+			deps = append(deps, pyprojectDependencies(slashed, content)...)
+		case name == "Cargo.toml":
+			deps = append(deps, cargoDependencies(slashed, content)...)
+		case name == "pom.xml":
+			deps = append(deps, pomDependencies(slashed, content)...)
+		case name == "Gemfile":
+			deps = append(deps, gemfileDependencies(slashed, content)...)
+		}
+	}
+	for i := range deps {
+		deps[i].Category = dependencyCategory(deps[i])
+	}
+	return deps
+}
+
+// dependencyCategory looks a dependency up by its full name and then by
+// each shorter prefix of it, so that e.g. every org.junit.jupiter artifact
+// counts as a test library.
+func dependencyCategory(dep Dependency) string {
+	name := strings.ToLower(dep.Name)
+	switch dep.Ecosystem {
+	case "go":
+		name = goMajorSuffix.ReplaceAllString(name, "")
+		for ; name != "." && name != ""; name = path.Dir(name) {
+			if category, ok := dependencyCategories[name]; ok {
+				return category
+			}
+		}
+		return ""
+	case "maven":
+		if category, ok := dependencyCategories[name]; ok {
+			return category
+		}
+		group, _, _ := strings.Cut(name, ":")
+		for {
+			if category, ok := dependencyCategories[group]; ok {
+				return category
+			}
+			i := strings.LastIndexByte(group, '.')
+			if i < 0 {
+				return ""
+			}
+			group = group[:i]
+		}
+	}
+	return dependencyCategories[name]
+}
+
+func goModDependencies(file, content string) []Dependency {
+	mod, err := modfile.ParseLax(file, []byte(content), nil)
+	if err != nil {
+		return nil
+	}
+	var deps []Dependency
+	for _, req := range mod.Require {
+		if req.Indirect {
+			continue
+		}
+		deps = append(deps, Dependency{Name: req.Mod.Path, Version: req.Mod.Version, Ecosystem: "go", Manifest: file, Scope: scopeRuntime})
+	}
+	return deps
+}
+
+func packageJSONDependencies(file, content string) []Dependency {
+	var pkg struct {
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		PeerDependencies     map[string]string `json:"peerDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if err := json.Unmarshal([]byte(content), &pkg); err != nil {
+		return nil
+	}
+
+	var deps []Dependency
+	for _, group := range []struct {
+		deps  map[string]string
+		scope string
+	}{
+		{pkg.Dependencies, scopeRuntime},
+		{pkg.PeerDependencies, scopeRuntime},
+		{pkg.OptionalDependencies, scopeOptional},
+		{pkg.DevDependencies, scopeDev},
+	} {
+		for _, name := range sortedKeys(group.deps) {
+			deps = append(deps, Dependency{Name: name, Version: group.deps[name], Ecosystem: "npm", Manifest: file, Scope: group.scope})
+		}
+	}
+	return deps
+}
+
+// parsePEP508 splits a Python requirement such as
+// "requests[socks]>=2.31; python_version >= '3.8'" into its name and
+// version specifier.
+func parsePEP508(requirement string) (name, version string, ok bool) {
+	requirement, _, _ = strings.Cut(requirement, ";")
+	m := pep508Requirement.FindStringSubmatch(strings.TrimSpace(requirement))
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], strings.Join(strings.Fields(m[2]), ""), true
+}
+
+func requirementsDependencies(file, content string) []Dependency {
+	scope := scopeRuntime
+	if base := path.Base(file); strings.Contains(base, "dev") {
+		scope = scopeDev
+	} else if strings.Contains(base, "test") {
+		scope = scopeTest
+	}
+
+	var deps []Dependency
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		// Options such as -r, -e and --index-url, and direct URLs.
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue
+		}
+		if name, version, ok := parsePEP508(line); ok {
+			deps = append(deps, Dependency{Name: name, Version: version, Ecosystem: "pypi", Manifest: file, Scope: scope})
+		}
+	}
+	return deps
+}
+
+func pyprojectDependencies(file, content string) []Dependency {
+	var pyproject struct {
+		Project struct {
+			Dependencies         []string            `toml:"dependencies"`
+			OptionalDependencies map[string][]string `toml:"optional-dependencies"`
+		} `toml:"project"`
+		DependencyGroups map[string][]any `toml:"dependency-groups"`
+		Tool             struct {
+			Poetry struct {
+				Dependencies    map[string]any `toml:"dependencies"`
+				DevDependencies map[string]any `toml:"dev-dependencies"`
+				Group           map[string]struct {
+					Dependencies map[string]any `toml:"dependencies"`
+				} `toml:"group"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+	}
+	if _, err := toml.Decode(content, &pyproject); err != nil {
+		return nil
+	}
+
+	var deps []Dependency
+	addRequirement := func(requirement, scope string) {
+		if name, version, ok := parsePEP508(requirement); ok {
+			deps = append(deps, Dependency{Name: name, Version: version, Ecosystem: "pypi", Manifest: file, Scope: scope})
+		}
+	}
+	addPoetry := func(table map[string]any, scope string) {
+		for _, name := range sortedKeys(table) {
+			if name == "python" {
+				continue
+			}
+			deps = append(deps, Dependency{Name: name, Version: tableVersion(table[name]), Ecosystem: "pypi", Manifest: file, Scope: scope})
+		}
+	}
+
+	for _, requirement := range pyproject.Project.Dependencies {
+		addRequirement(requirement, scopeRuntime)
+	}
+	for _, extra := range sortedKeys(pyproject.Project.OptionalDependencies) {
+		for _, requirement := range pyproject.Project.OptionalDependencies[extra] {
+			addRequirement(requirement, scopeOptional)
+		}
+	}
+	for _, group := range sortedKeys(pyproject.DependencyGroups) {
+		for _, requirement := range pyproject.DependencyGroups[group] {
+			// Entries can also be {include-group = "..."} tables.
+			if s, ok := requirement.(string); ok {
+				addRequirement(s, groupScope(group))
+			}
+		}
+	}
+	addPoetry(pyproject.Tool.Poetry.Dependencies, scopeRuntime)
+	addPoetry(pyproject.Tool.Poetry.DevDependencies, scopeDev)
+	for _, group := range sortedKeys(pyproject.Tool.Poetry.Group) {
+		addPoetry(pyproject.Tool.Poetry.Group[group].Dependencies, groupScope(group))
+	}
+	return deps
+}
+
+// groupScope maps a named dependency group, as used by Poetry, PEP 735 and
+// Bundler, to a scope.
+func groupScope(group string) string {
+	switch strings.ToLower(group) {
+	case "test", "tests", "testing":
+		return scopeTest
+	case "build":
+		return scopeBuild
+	default:
+		return scopeDev
+	}
+}
+
+// tableVersion returns the version of a dependency given either as a plain
+// version string or as a table such as { version = "1.0", features = [...] }.
+func tableVersion(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]any:
+		if version, ok := v["version"].(string); ok {
+			return version
+		}
+		for _, source := range []string{"git", "path", "url"} {
+			if location, ok := v[source].(string); ok {
+				return source + ":" + location
+			}
+		}
+	}
+	return ""
+}
+
+func cargoDependencies(file, content string) []Dependency {
+	var cargo struct {
+		Dependencies      map[string]any `toml:"dependencies"`
+		DevDependencies   map[string]any `toml:"dev-dependencies"`
+		BuildDependencies map[string]any `toml:"build-dependencies"`
+		Workspace         struct {
+			Dependencies map[string]any `toml:"dependencies"`
+		} `toml:"workspace"`
+	}
+	if _, err := toml.Decode(content, &cargo); err != nil {
+		return nil
+	}
+
+	var deps []Dependency
+	for _, group := range []struct {
+		deps  map[string]any
+		scope string
+	}{
+		{cargo.Dependencies, scopeRuntime},
+		{cargo.Workspace.Dependencies, scopeRuntime},
+		{cargo.BuildDependencies, scopeBuild},
+		{cargo.DevDependencies, scopeDev},
+	} {
+		for _, name := range sortedKeys(group.deps) {
+			crate := name
+			// Renamed dependencies: foo = { package = "real-name", ... }.
+			if table, ok := group.deps[name].(map[string]any); ok {
+				if pkg, ok := table["package"].(string); ok {
+					crate = pkg
+				}
+			}
+			deps = append(deps, Dependency{Name: crate, Version: tableVersion(group.deps[name]), Ecosystem: "cargo", Manifest: file, Scope: group.scope})
+		}
+	}
+	return deps
+}
+
+func pomDependencies(file, content string) []Dependency {
+	type pomDependency struct {
+		GroupID    string `xml:"groupId"`
+		ArtifactID string `xml:"artifactId"`
+		Version    string `xml:"version"`
+		Scope      string `xml:"scope"`
+		Optional   bool   `xml:"optional"`
+	}
+	var pom struct {
+		Version    string `xml:"version"`
+		Properties struct {
+			Entries []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"properties"`
+		Dependencies []pomDependency `xml:"dependencies>dependency"`
+	}
+	if err := xml.Unmarshal([]byte(content), &pom); err != nil {
+		return nil
+	}
+
+	properties := map[string]string{"project.version": pom.Version}
+	for _, entry := range pom.Properties.Entries {
+		properties[entry.XMLName.Local] = strings.TrimSpace(entry.Value)
+	}
+	resolve := func(s string) string {
+		return pomProperty.ReplaceAllStringFunc(strings.TrimSpace(s), func(ref string) string {
+			if value, ok := properties[ref[2:len(ref)-1]]; ok {
+				return value
+			}
+			return ref
+		})
+	}
+
+	var deps []Dependency
+	for _, d := range pom.Dependencies {
+		scope := scopeRuntime
+		switch {
+		case d.Optional:
+			scope = scopeOptional
+		case d.Scope == "test":
+			scope = scopeTest
+		case d.Scope == "provided":
+			scope = scopeBuild
+		}
+		name := resolve(d.GroupID) + ":" + resolve(d.ArtifactID)
+		deps = append(deps, Dependency{Name: name, Version: resolve(d.Version), Ecosystem: "maven", Manifest: file, Scope: scope})
+	}
+	return deps
+}
+
+func gemfileDependencies(file, content string) []Dependency {
+	var deps []Dependency
+	var groups []string
+	depth := 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if m := gemfileGroup.FindStringSubmatch(line); m != nil {
+			groups = rubySymbols(m[1])
+			depth = 1
+			continue
+		}
+		if depth > 0 {
+			if strings.HasSuffix(line, " do") || line == "do" {
+				depth++
+			} else if line == "end" {
+				if depth--; depth == 0 {
+					groups = nil
+				}
+				continue
+			}
+		}
+
+		m := gemfileGem.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		lineGroups := groups
+		if g := gemfileInlineGrp.FindStringSubmatch(line); g != nil {
+			lineGroups = rubySymbols(g[1] + g[2])
+		}
+		scope := scopeRuntime
+		if len(lineGroups) > 0 && !slices.Contains(lineGroups, "default") && !slices.Contains(lineGroups, "production") {
+			scope = scopeDev
+			if slices.Contains(lineGroups, "test") {
+				scope = scopeTest
+			}
+		}
+		version := m[2]
+		if m[3] != "" {
+			version += ", " + m[3]
+		}
+		deps = append(deps, Dependency{Name: m[1], Version: version, Ecosystem: "rubygems", Manifest: file, Scope: scope})
+	}
+	return deps
+}
+
+// rubySymbols turns a list such as ":development, :test" into its names.
+func rubySymbols(list string) []string {
+	var names []string
+	for _, field := range strings.Split(list, ",") {
+		if name := strings.Trim(strings.TrimSpace(field), `:"'`); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// formatDependencies summarizes dependencies for prompts, one line per
+// manifest and scope, with categorized libraries called out first.
+func formatDependencies(deps []Dependency, maxTokens int) string {
+	if len(deps) == 0 {
+		return "none found"
+	}
+
+	type group struct {
+		manifest, scope string
+	}
+	var order []group
+	byGroup := make(map[group][]Dependency)
+	for _, dep := range deps {
+		g := group{dep.Manifest, dep.Scope}
+		if _, ok := byGroup[g]; !ok {
+			order = append(order, g)
+		}
+		byGroup[g] = append(byGroup[g], dep)
+	}
+
+	var lines []string
+	for _, g := range order {
+		groupDeps := byGroup[g]
+		sort.SliceStable(groupDeps, func(i, j int) bool {
+			return groupDeps[i].Category != "" && groupDeps[j].Category == ""
+		})
+		var parts []string
+		for _, dep := range groupDeps {
+			part := dep.Name
+			if dep.Version != "" {
+				part += " " + dep.Version
+			}
+			if dep.Category != "" {
+				part += " (" + dep.Category + ")"
+			}
+			parts = append(parts, part)
+		}
+		lines = append(lines, fmt.Sprintf("- %s [%s]: %s", g.manifest, g.scope, strings.Join(parts, ", ")))
+	}
+	return strings.Join(capLines(lines, maxTokens, "manifests"), "\n")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseDependencies(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		// content of file
+		content string
+		// want lists name, version, scope and category for each dependency.
+		want []string
+	}{
+		{
+			name: "go.mod",
+			file: "go.mod",
+			content: `module example.com/app
+
+go 1.22
+
+require (
+	github.com/spf13/cobra v1.8.0
+	github.com/gin-gonic/gin/v2 v2.0.0
+	golang.org/x/text v0.14.0 // indirect
+)
+`,
+			want: []string{
+				"github.com/spf13/cobra v1.8.0 runtime CLI library",
+				"github.com/gin-gonic/gin/v2 v2.0.0 runtime web framework",
+			},
+		},
+		{
+			name: "package.json",
+			file: "web/package.json",
+			content: `{
+  "dependencies": {"express": "^4.18.0", "left-pad": "1.3.0"},
+  "devDependencies": {"jest": "^29.0.0"},
+  "optionalDependencies": {"fsevents": "2.3.3"}
+}`,
+			want: []string{
+				"express ^4.18.0 runtime web framework",
+				"left-pad 1.3.0 runtime ",
+				"fsevents 2.3.3 optional ",
+				"jest ^29.0.0 dev test library",
+			},
+		},
+		{
+			name: "requirements.txt",
+			file: "requirements.txt",
+			content: `# web
+flask==3.0.0  # pinned
+requests[socks] >= 2.31 ; python_version >= "3.8"
+-r other.txt
+git+https://example.com/x.git
+`,
+			want: []string{
+				"flask ==3.0.0 runtime web framework",
+				"requests >=2.31 runtime ",
+			},
+		},
+		{
+			name:    "requirements-dev.txt",
+			file:    "requirements-dev.txt",
+			content: "pytest>=8\n",
+			want:    []string{"pytest >=8 dev test library"},
+		},
+		{
+			name: "pyproject.toml",
+			file: "pyproject.toml",
+			content: `[project]
+dependencies = ["fastapi>=0.110"]
+
+[project.optional-dependencies]
+cli = ["click"]
+
+[dependency-groups]
+test = ["pytest"]
+`,
+			want: []string{
+				"fastapi >=0.110 runtime web framework",
+				"click  optional CLI library",
+				"pytest  test test library",
+			},
+		},
+		{
+			name: "Cargo.toml",
+			file: "Cargo.toml",
+			content: `[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+tokio = "1"
+
+[dev-dependencies]
+criterion = "0.5"
+`,
+			want: []string{
+				"serde 1.0 runtime ",
+				"tokio 1 runtime ",
+				"criterion 0.5 dev test library",
+			},
+		},
+		{
+			name: "pom.xml",
+			file: "pom.xml",
+			content: `<project>
+  <properties><junit.version>5.10.0</junit.version></properties>
+  <dependencies>
+    <dependency>
+      <groupId>org.junit.jupiter</groupId>
+      <artifactId>junit-jupiter</artifactId>
+      <version>${junit.version}</version>
+      <scope>test</scope>
+    </dependency>
+    <dependency>
+      <groupId>com.example</groupId>
+      <artifactId>lib</artifactId>
+      <version>1.0</version>
+    </dependency>
+  </dependencies>
+</project>`,
+			want: []string{
+				"org.junit.jupiter:junit-jupiter 5.10.0 test test library",
+				"com.example:lib 1.0 runtime ",
+			},
+		},
+		{
+			name: "Gemfile",
+			file: "Gemfile",
+			content: `source "https://rubygems.org"
+gem "rails", "~> 7.1"
+gem "rspec-rails", group: :test
+
+group :development do
+  gem "pry"
+end
+`,
+			want: []string{
+				"rails ~> 7.1 runtime web framework",
+				"rspec-rails  test test library",
+				"pry  dev ",
+			},
+		},
+		{
+			name:    "vendored",
+			file:    "vendor/github.com/x/y/go.mod",
+			content: "module github.com/x/y\n\nrequire github.com/spf13/cobra v1.8.0\n",
+		},
+		{
+			name:    "malformed",
+			file:    "package.json",
+			content: "{not json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, dep := range parseDependencies(map[string]string{tt.file: tt.content}) {
+				if dep.Manifest != tt.file {
+					t.Errorf("%s has manifest %s, want %s", dep.Name, dep.Manifest, tt.file)
+				}
+				got = append(got, fmt.Sprintf("%s %s %s %s", dep.Name, dep.Version, dep.Scope, dep.Category))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dependencies =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
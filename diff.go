@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type changedFile struct {
+	Status string
+	Path   string
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir, "-c", "core.quotePath=false"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// gitChangedFiles lists the files touched by revRange, which is anything
+// git diff accepts: "base..head", "base...head", or a single revision that is
+// compared against the working tree. External diff drivers and textconv
+// filters are turned off so the patches are git's own, and
+// --end-of-options keeps a range starting with "-" from being read as an
+// option. -z keeps paths with quotes, tabs or newlines unquoted.
+func gitChangedFiles(ctx context.Context, dir, revRange string) ([]changedFile, error) {
+	out, err := git(ctx, dir, "diff", "--no-ext-diff", "--no-textconv", "--name-status", "-z", "--no-renames", "--relative", "--end-of-options", revRange)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without renames, every status is followed by a single path.
+	var files []changedFile
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		files = append(files, changedFile{Status: fields[i], Path: fields[i+1]})
+	}
+	return files, nil
+}
+
+func diffStatusName(status string) string {
+	switch status {
+	case "A":
+		return "added"
+	case "D":
+		return "deleted"
+	case "M":
+		return "modified"
+	case "T":
+		return "type changed"
+	default:
+		return status
+	}
+}
+
+// describeDiff asks the model to explain the changes in revRange against the
+// project description written by a previous describe run.
+func (p *pipeline) describeDiff(ctx context.Context, dirPath, revRange string) error {
+	completer, outputDir, tokenBudget := p.completer, p.outputDir, p.tokenBudget
+	projectName := filepath.Base(dirPath)
+
+	changed, err := gitChangedFiles(ctx, dirPath, revRange)
+	if err != nil {
+		return fmt.Errorf("failed to list changed files: %w", err)
+	}
+
+	ignore, err := p.loadIgnore(ctx, dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to read ignore files: %w", err)
+	}
+
+	patches := make(map[string]string)
+	for _, file := range changed {
+		ignored, err := ignore.ignoredPath(file.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read ignore files: %w", err)
+		}
+		if ignored {
+			continue
+		}
+		// A literal pathspec keeps *, ? and [ in a file name from matching
+		// other files.
+		patch, err := git(ctx, dirPath, "diff", "--no-ext-diff", "--no-textconv", "--end-of-options", revRange, "--", ":(literal)"+file.Path)
+		if err != nil {
+			return fmt.Errorf("failed to diff %s: %w", file.Path, err)
+		}
+		// Patches of lockfiles and generated bundles are cut down like the
+		// files themselves.
+		patch, note := limitContent(patch, p.limits)
+		label := diffStatusName(file.Status)
+		if note != "" {
+			label += ", " + note
+		}
+		patches[fmt.Sprintf("%s (%s)", file.Path, label)] = patch
+	}
+	if len(patches) == 0 {
+		return errors.New("no changed files in " + revRange)
+	}
+	progressf("Describing %d changed files in %s\n", len(patches), revRange)
+
+	redactions := redactFiles(patches, p.redactRules)
+	if err := writeRedactionReport(outputDir, redactions); err != nil {
+		return fmt.Errorf("failed to write redaction report: %w", err)
+	}
+
+	description := "No project description is available yet; run a describe first for better results."
+	existing, err := os.ReadFile(filepath.Join(p.descriptionDir, "project_description.md"))
+	if err == nil {
+		description = string(existing)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read project description: %w", err)
+	}
+
+	commits, err := git(ctx, dirPath, "log", "--oneline", "--no-decorate", "--end-of-options", revRange)
+	if err != nil {
+		// A single revision compared against the working tree is not a
+		// valid log range; the changes still speak for themselves.
+		commits = ""
+	}
+
+	var blocks []string
+	for _, path := range sortedKeys(patches) {
+		blocks = append(blocks, renderFile(path, patches[path]))
+	}
+	changes := strings.Join(blocks, "")
+
+	data := promptData{ProjectName: projectName, PreviousDescription: description, Commits: commits, Code: changes}
+	if tokens := p.prompts.tokens(stageDiff, data); tokens > tokenBudget {
+		progressf("Diff is about %d tokens, over the %d token budget; summarizing changes in chunks\n", tokens, tokenBudget)
+
+		chunkData := func(chunk string) promptData { return promptData{ProjectName: projectName, Code: chunk} }
+		summaries, err := p.summarizeChunks(ctx, stageDiffChunk, chunkData, patches)
+		if err != nil {
+			return fmt.Errorf("failed to summarize changes: %w", err)
+		}
+		data.Code = ""
+		target := max(tokenBudget-p.prompts.tokens(stageDiff, data), tokenBudget/4)
+		summaries, err = p.mergeSummaries(ctx, projectName, summaries, target)
+		if err != nil {
+			return fmt.Errorf("failed to summarize changes: %w", err)
+		}
+		data.Code = strings.Join(summaries, "\n\n")
+	}
+
+	summary, err := complete(ctx, completer, p.prompts, stageDiff, data)
+	if err != nil {
+		return fmt.Errorf("failed to call LLM for diff description: %w", err)
+	}
+
+	mdFilePath := filepath.Join(outputDir, "diff_"+safeFileName(revRange)+".md")
+	if err := writeFile(mdFilePath, []byte(summary)); err != nil {
+		return fmt.Errorf("failed to write Markdown file: %w", err)
+	}
+
+	progressf("Diff description written to %s\n", mdFilePath)
+	return nil
+}
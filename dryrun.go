@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dryRunDir is where a dry run writes everything, inside the output
+// directory, so that the results of real runs are left alone.
+const dryRunDir = "dry_run"
+
+// dryRunCompleter writes every request to a file instead of sending it, and
+// answers with the fake provider's placeholder so the rest of the pipeline
+// runs as it would. Files are numbered in the order the requests are made.
+type dryRunCompleter struct {
+	dir         string
+	price       modelPrice
+	priced      bool
+	placeholder Completer
+
+	mu    sync.Mutex
+	count int
+}
+
+func newDryRunCompleter(dir string, cfg ProviderConfig, price modelPrice, priced bool) (*dryRunCompleter, error) {
+	// Prompts left over from an earlier dry run would be mistaken for this
+	// one's.
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	placeholder, err := newFakeCompleter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &dryRunCompleter{dir: dir, price: price, priced: priced, placeholder: placeholder}, nil
+}
+
+func (c *dryRunCompleter) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	if err := ctx.Err(); err != nil {
+		return Completion{}, err
+	}
+	c.mu.Lock()
+	c.count++
+	n := c.count
+	c.mu.Unlock()
+
+	systemTokens, promptTokens := estimateTokens(req.System), estimateTokens(req.Prompt)
+	tokens := systemTokens + promptTokens
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stage: %s\n", req.Stage)
+	fmt.Fprintf(&b, "Estimated tokens: %d (system %d, prompt %d)\n", tokens, systemTokens, promptTokens)
+	if c.priced {
+		fmt.Fprintf(&b, "Projected cost: $%.4f for the prompt, at $%g per million tokens\n", c.price.cost(Usage{PromptTokens: tokens}), c.price.Input)
+	} else {
+		b.WriteString("Projected cost: unknown, no price is known for the model\n")
+	}
+	if req.Schema != nil {
+		fmt.Fprintf(&b, "Structured output: %s\n", req.SchemaName)
+	}
+	fmt.Fprintf(&b, "\n## System\n\n%s\n\n## Prompt\n\n%s\n", req.System, req.Prompt)
+
+	file := filepath.Join(c.dir, fmt.Sprintf("%04d-%s.md", n, req.Stage))
+	if err := writeFile(file, []byte(b.String())); err != nil {
+		return Completion{}, fmt.Errorf("failed to write prompt: %w", err)
+	}
+	debugf("Prompt %d (%s, about %d tokens) written to %s\n", n, req.Stage, tokens, file)
+
+	resp, err := c.placeholder.Complete(ctx, req)
+	if err != nil {
+		return Completion{}, err
+	}
+	// The reply is only a placeholder, so only the prompt counts.
+	resp.Usage = Usage{PromptTokens: tokens}
+	return resp, nil
+}
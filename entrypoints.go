@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"maps"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+type EntryPoint struct {
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name,omitempty"`
+	Evidence string `json:"evidence"`
+}
+
+var (
+	pythonMainGuard  = regexp.MustCompile(`(?m)^if\s+__name__\s*==\s*["']__main__["']\s*:`)
+	dockerInstr      = regexp.MustCompile(`(?i)^(FROM|ENTRYPOINT|CMD)\s+(.+)$`)
+	dockerHeredoc    = regexp.MustCompile(`(?:^|[^<])<<-?\s*["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+	makefileTarget   = regexp.MustCompile(`(?m)^([A-Za-z0-9][A-Za-z0-9_./-]*)\s*::?([^:=]|$)`)
+	makefileDefault  = regexp.MustCompile(`(?m)^\.DEFAULT_GOAL\s*:?=\s*(\S+)`)
+	rustMainFunction = regexp.MustCompile(`(?m)^\s*(pub\s+)?fn\s+main\s*\(`)
+)
+
+// discoverEntryPoints looks for the ways a repository is meant to be run,
+// using each ecosystem's own conventions, and records the evidence for each.
+func discoverEntryPoints(code map[string]string) []EntryPoint {
+	var found []EntryPoint
+	for _, file := range sortedKeys(code) {
+		content := code[file]
+		slashed := filepath.ToSlash(file)
+		dir, name := path.Split(slashed)
+
+		switch {
+		case strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go"):
+			found = append(found, goEntryPoints(slashed, content)...)
+		case name == "package.json":
+			found = append(found, packageJSONEntryPoints(slashed, content)...)
+		case name == "pyproject.toml":
+			found = append(found, pyprojectEntryPoints(slashed, content)...)
+		case name == "__main__.py":
+			found = append(found, EntryPoint{Path: slashed, Kind: "python-module", Name: path.Base(strings.TrimSuffix(dir, "/")), Evidence: "__main__.py makes the package runnable with python -m"})
+		case strings.HasSuffix(name, ".py") && pythonMainGuard.MatchString(content):
+			found = append(found, EntryPoint{Path: slashed, Kind: "python-script", Evidence: `if __name__ == "__main__" guard`})
+		case name == "Cargo.toml":
+			found = append(found, cargoEntryPoints(slashed, content, code)...)
+		case name == "Dockerfile" || strings.HasPrefix(name, "Dockerfile.") || name == "Containerfile":
+			found = append(found, dockerfileEntryPoints(slashed, content)...)
+		case name == "Makefile" || name == "makefile" || name == "GNUmakefile":
+			found = append(found, makefileEntryPoints(slashed, content)...)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+	return found
+}
+
+func goEntryPoints(file, content string) []EntryPoint {
+	f, err := parser.ParseFile(token.NewFileSet(), file, content, parser.SkipObjectResolution)
+	if err != nil || f.Name.Name != "main" {
+		return nil
+	}
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+			return []EntryPoint{{
+				Path:     file,
+				Kind:     "go-main",
+				Name:     goCommandName(file),
+				Evidence: "package main declares func main",
+			}}
+		}
+	}
+	return nil
+}
+
+// goCommandName is the binary name go build gives a main package: its
+// directory name, e.g. "foo" for cmd/foo/main.go.
+func goCommandName(file string) string {
+	dir := path.Dir(file)
+	if dir == "." {
+		return ""
+	}
+	return path.Base(dir)
+}
+
+func packageJSONEntryPoints(file, content string) []EntryPoint {
+	var pkg struct {
+		Name    string            `json:"name"`
+		Main    string            `json:"main"`
+		Bin     json.RawMessage   `json:"bin"`
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal([]byte(content), &pkg); err != nil {
+		return nil
+	}
+
+	var found []EntryPoint
+	if pkg.Main != "" {
+		found = append(found, EntryPoint{Path: file, Kind: "npm-main", Name: pkg.Name, Evidence: fmt.Sprintf("main = %q", pkg.Main)})
+	}
+
+	var bin string
+	var bins map[string]string
+	if json.Unmarshal(pkg.Bin, &bin) == nil && bin != "" {
+		bins = map[string]string{pkg.Name: bin}
+	} else {
+		json.Unmarshal(pkg.Bin, &bins)
+	}
+	for _, name := range sortedKeys(bins) {
+		found = append(found, EntryPoint{Path: file, Kind: "npm-bin", Name: name, Evidence: fmt.Sprintf("bin.%s = %q", name, bins[name])})
+	}
+
+	for _, name := range sortedKeys(pkg.Scripts) {
+		found = append(found, EntryPoint{Path: file, Kind: "npm-script", Name: name, Evidence: fmt.Sprintf("scripts.%s = %q", name, pkg.Scripts[name])})
+	}
+	return found
+}
+
+func pyprojectEntryPoints(file, content string) []EntryPoint {
+	var pyproject struct {
+		Project struct {
+			Scripts    map[string]string `toml:"scripts"`
+			GUIScripts map[string]string `toml:"gui-scripts"`
+		} `toml:"project"`
+		Tool struct {
+			Poetry struct {
+				Scripts map[string]any `toml:"scripts"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+	}
+	if _, err := toml.Decode(content, &pyproject); err != nil {
+		return nil
+	}
+
+	var found []EntryPoint
+	for _, name := range sortedKeys(pyproject.Project.Scripts) {
+		found = append(found, EntryPoint{Path: file, Kind: "python-console-script", Name: name, Evidence: fmt.Sprintf("[project.scripts] %s = %q", name, pyproject.Project.Scripts[name])})
+	}
+	for _, name := range sortedKeys(pyproject.Project.GUIScripts) {
+		found = append(found, EntryPoint{Path: file, Kind: "python-gui-script", Name: name, Evidence: fmt.Sprintf("[project.gui-scripts] %s = %q", name, pyproject.Project.GUIScripts[name])})
+	}
+	poetry := make(map[string]string)
+	for name, target := range pyproject.Tool.Poetry.Scripts {
+		poetry[name] = fmt.Sprint(target)
+	}
+	for _, name := range sortedKeys(poetry) {
+		found = append(found, EntryPoint{Path: file, Kind: "python-console-script", Name: name, Evidence: fmt.Sprintf("[tool.poetry.scripts] %s = %s", name, poetry[name])})
+	}
+	return found
+}
+
+func cargoEntryPoints(file, content string, code map[string]string) []EntryPoint {
+	var cargo struct {
+		Package struct {
+			Name string `toml:"name"`
+		} `toml:"package"`
+		Bin []struct {
+			Name string `toml:"name"`
+			Path string `toml:"path"`
+		} `toml:"bin"`
+	}
+	if _, err := toml.Decode(content, &cargo); err != nil {
+		return nil
+	}
+
+	dir := path.Dir(file)
+	var found []EntryPoint
+	for _, bin := range cargo.Bin {
+		target := bin.Path
+		if target == "" {
+			target = "src/bin/" + bin.Name + ".rs"
+		}
+		found = append(found, EntryPoint{Path: path.Join(dir, target), Kind: "cargo-bin", Name: bin.Name, Evidence: fmt.Sprintf("[[bin]] name = %q in %s", bin.Name, file)})
+	}
+
+	// Cargo's automatic target discovery.
+	mainRS := path.Join(dir, "src", "main.rs")
+	if content, ok := code[filepath.FromSlash(mainRS)]; ok && rustMainFunction.MatchString(content) {
+		found = append(found, EntryPoint{Path: mainRS, Kind: "cargo-bin", Name: cargo.Package.Name, Evidence: "src/main.rs next to " + file})
+	}
+	binDir := path.Join(dir, "src", "bin") + "/"
+	for _, other := range sortedKeys(code) {
+		other = filepath.ToSlash(other)
+		if strings.HasPrefix(other, binDir) && strings.HasSuffix(other, ".rs") && !strings.Contains(strings.TrimPrefix(other, binDir), "/") {
+			found = append(found, EntryPoint{Path: other, Kind: "cargo-bin", Name: strings.TrimSuffix(path.Base(other), ".rs"), Evidence: "src/bin/ next to " + file})
+		}
+	}
+	return found
+}
+
+func dockerfileEntryPoints(file, content string) []EntryPoint {
+	// Only the last ENTRYPOINT and CMD of the final stage take effect. A
+	// stage built FROM an earlier one starts with that stage's.
+	last := make(map[string]string)
+	stages := make(map[string]map[string]string)
+	for _, line := range dockerInstructions(content) {
+		m := dockerInstr.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		instr, value := strings.ToUpper(m[1]), strings.TrimSpace(m[2])
+		if instr != "FROM" {
+			last[instr] = value
+			continue
+		}
+		var args []string
+		for _, field := range strings.Fields(value) {
+			if !strings.HasPrefix(field, "--") {
+				args = append(args, field)
+			}
+		}
+		last = make(map[string]string)
+		if len(args) > 0 {
+			maps.Copy(last, stages[strings.ToLower(args[0])])
+		}
+		if len(args) == 3 && strings.EqualFold(args[1], "AS") {
+			stages[strings.ToLower(args[2])] = last
+		}
+	}
+
+	var found []EntryPoint
+	for _, instr := range []string{"ENTRYPOINT", "CMD"} {
+		if value, ok := last[instr]; ok {
+			found = append(found, EntryPoint{Path: file, Kind: "docker-" + strings.ToLower(instr), Evidence: instr + " " + value})
+		}
+	}
+	return found
+}
+
+// dockerInstructions splits a Dockerfile into its instructions, joining lines
+// continued with a backslash and dropping comments and heredoc bodies, so
+// that a line inside a RUN is never taken for an instruction of its own.
+func dockerInstructions(content string) []string {
+	var instructions []string
+	var current []string
+	var heredocs []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(heredocs) > 0 {
+			if strings.TrimSpace(line) == heredocs[0] {
+				heredocs = heredocs[1:]
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") || (trimmed == "" && len(current) > 0) {
+			continue
+		}
+		if rest, continued := strings.CutSuffix(trimmed, "\\"); continued {
+			current = append(current, rest)
+			continue
+		}
+		current = append(current, trimmed)
+		instruction := strings.Join(current, " ")
+		current = nil
+		// Only RUN, COPY and ADD take heredocs.
+		if keyword, _, _ := strings.Cut(instruction, " "); slices.Contains([]string{"RUN", "COPY", "ADD"}, strings.ToUpper(keyword)) {
+			for _, m := range dockerHeredoc.FindAllStringSubmatch(instruction, -1) {
+				heredocs = append(heredocs, m[1])
+			}
+		}
+		if instruction != "" {
+			instructions = append(instructions, instruction)
+		}
+	}
+	if len(current) > 0 {
+		instructions = append(instructions, strings.Join(current, " "))
+	}
+	return instructions
+}
+
+func makefileEntryPoints(file, content string) []EntryPoint {
+	var found []EntryPoint
+	seen := make(map[string]bool)
+	first := ""
+	for _, m := range makefileTarget.FindAllStringSubmatch(content, -1) {
+		target := m[1]
+		if seen[target] || strings.Contains(target, "%") {
+			continue
+		}
+		seen[target] = true
+		if first == "" {
+			first = target
+		}
+		found = append(found, EntryPoint{Path: file, Kind: "make-target", Name: target, Evidence: "target " + target})
+	}
+
+	goal := first
+	if m := makefileDefault.FindStringSubmatch(content); m != nil {
+		goal = m[1]
+	}
+	for i := range found {
+		if found[i].Name == goal {
+			found[i].Evidence += " (default goal)"
+		}
+	}
+	return found
+}
+
+func formatEntryPoints(entryPoints []EntryPoint, maxTokens int) string {
+	if len(entryPoints) == 0 {
+		return "none found"
+	}
+	var lines []string
+	for _, ep := range entryPoints {
+		line := fmt.Sprintf("- %s [%s]", ep.Path, ep.Kind)
+		if ep.Name != "" {
+			line += " " + ep.Name
+		}
+		lines = append(lines, line+": "+ep.Evidence)
+	}
+	return strings.Join(capLines(lines, maxTokens, "entry points"), "\n")
+}
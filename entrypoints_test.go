@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverEntryPoints(t *testing.T) {
+	tests := []struct {
+		name string
+		code map[string]string
+		// want lists path, kind, name and evidence for each entry point.
+		want []string
+	}{
+		{
+			name: "go commands",
+			code: map[string]string{
+				"main.go":         "package main\n\nfunc main() {}\n",
+				"cmd/tool/cli.go": "package main\n\nfunc main() {}\n",
+				"lib/lib.go":      "package lib\n\nfunc main() {}\n",
+				"cmd/x/x_test.go": "package main\n\nfunc main() {}\n",
+				"broken/main.go":  "package main\n\nfunc main( {\n",
+			},
+			want: []string{
+				"cmd/tool/cli.go go-main tool: package main declares func main",
+				"main.go go-main : package main declares func main",
+			},
+		},
+		{
+			name: "package.json",
+			code: map[string]string{
+				"package.json": `{"name": "app", "main": "index.js", "bin": "cli.js", "scripts": {"start": "node index.js"}}`,
+			},
+			want: []string{
+				`package.json npm-main app: main = "index.js"`,
+				`package.json npm-bin app: bin.app = "cli.js"`,
+				`package.json npm-script start: scripts.start = "node index.js"`,
+			},
+		},
+		{
+			name: "python",
+			code: map[string]string{
+				"pkg/__main__.py": "print('hi')\n",
+				"run.py":          "def main():\n    pass\n\nif __name__ == '__main__':\n    main()\n",
+				"lib.py":          "def main():\n    pass\n",
+				"pyproject.toml":  "[project.scripts]\napp = \"pkg.cli:main\"\n",
+			},
+			want: []string{
+				"pkg/__main__.py python-module pkg: __main__.py makes the package runnable with python -m",
+				`pyproject.toml python-console-script app: [project.scripts] app = "pkg.cli:main"`,
+				`run.py python-script : if __name__ == "__main__" guard`,
+			},
+		},
+		{
+			name: "cargo",
+			code: map[string]string{
+				"Cargo.toml":      "[package]\nname = \"app\"\n",
+				"src/main.rs":     "fn main() {}\n",
+				"src/bin/tool.rs": "fn main() {}\n",
+			},
+			want: []string{
+				"src/bin/tool.rs cargo-bin tool: src/bin/ next to Cargo.toml",
+				"src/main.rs cargo-bin app: src/main.rs next to Cargo.toml",
+			},
+		},
+		{
+			name: "dockerfile final stage",
+			code: map[string]string{
+				"Dockerfile": "FROM golang AS build\nENTRYPOINT [\"/bin/sh\"]\nCMD [\"go\", \"test\"]\nFROM alpine\nCMD [\"/app\"]\n",
+			},
+			want: []string{`Dockerfile docker-cmd : CMD ["/app"]`},
+		},
+		{
+			name: "dockerfile inherited stage",
+			code: map[string]string{
+				"Dockerfile": "FROM alpine AS base\nENTRYPOINT [\"/app\"]\nFROM base\nCMD [\"serve\"]\n",
+			},
+			want: []string{
+				`Dockerfile docker-entrypoint : ENTRYPOINT ["/app"]`,
+				`Dockerfile docker-cmd : CMD ["serve"]`,
+			},
+		},
+		{
+			name: "dockerfile continuations and heredocs",
+			code: map[string]string{
+				"Dockerfile": "FROM alpine\nRUN apk add \\\n  from \\\n  cmd\nRUN <<EOF\nfrom scratch\nEOF\n# CMD [\"commented\"]\nCMD \\\n  [\"/app\"]\n",
+			},
+			want: []string{`Dockerfile docker-cmd : CMD ["/app"]`},
+		},
+		{
+			name: "makefile",
+			code: map[string]string{
+				"Makefile": "A ::= 1\nB :::= 2\nC := 3\nD = 4\nbuild: dep\n\tgo build\nclean::\n\trm -f x\n%.o: %.c\n\tcc $<\n.DEFAULT_GOAL := test\ntest:\n",
+			},
+			want: []string{
+				"Makefile make-target build: target build",
+				"Makefile make-target clean: target clean",
+				"Makefile make-target test: target test (default goal)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, ep := range discoverEntryPoints(tt.code) {
+				got = append(got, fmt.Sprintf("%s %s %s: %s", ep.Path, ep.Kind, ep.Name, ep.Evidence))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entry points =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// envFileName is looked for in the working directory, the repository and
+// the user config directory.
+const envFileName = ".env"
+
+// envFiles returns the .env files to load, most important first. An
+// explicit envFile replaces the search.
+func envFiles(repoPath, envFile string) []string {
+	if envFile != "" {
+		return []string{envFile}
+	}
+	var files []string
+	seen := make(map[string]bool)
+	dirs := []string{".", repoPath}
+	if dir := userConfigDir(); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		file := filepath.Join(dir, envFileName)
+		abs, err := filepath.Abs(file)
+		if err != nil || seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// loadEnvFiles sets the variables in the .env files that are not already
+// set, so the real environment always wins, and earlier files win over later
+// ones. A .env file in the repository is not trusted: only the providers' API
+// key variables and the DESCRIBE_* variables for keys a repository config may
+// set are taken from it, since variables such as GIT_EXTERNAL_DIFF or
+// HTTPS_PROXY would let a cloned repository run commands or intercept the
+// API key. DESCRIBE_OUTPUT_DIR is not taken from it either: unlike output_dir
+// in a repository config, it is not relative to the repository, so it could
+// not be kept inside it.
+func loadEnvFiles(repoPath, envFile string) ([]string, error) {
+	repoEnv, _ := filepath.Abs(filepath.Join(repoPath, envFileName))
+	files := envFiles(repoPath, envFile)
+	for _, file := range files {
+		vars, err := godotenv.Read(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		abs, _ := filepath.Abs(file)
+		for name, value := range vars {
+			if abs == repoEnv && envFile == "" && !repoAllowedEnv(name) {
+				continue
+			}
+			if _, set := os.LookupEnv(name); !set {
+				os.Setenv(name, value)
+			}
+		}
+	}
+	return files, nil
+}
+
+func repoAllowedEnv(name string) bool {
+	for _, p := range providers {
+		if p.keyEnv != "" && name == p.keyEnv {
+			return true
+		}
+	}
+	for _, key := range configKeys() {
+		if name == configEnvPrefix+strings.ToUpper(key) {
+			return key != "output_dir" && !slices.Contains(repoConfigForbidden, key)
+		}
+	}
+	return false
+}
+
+// resolveConfigWithEnv resolves the configuration once to find env_file,
+// loads the .env files, and resolves it again so DESCRIBE_* variables from
+// those files take effect.
+func resolveConfigWithEnv(repoPath string, flags *flag.FlagSet) (*Config, error) {
+	cfg, err := resolveConfig(repoPath, flags)
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := loadEnvFiles(repoPath, cfg.EnvFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(loaded) > 0 {
+		if cfg, err = resolveConfig(repoPath, flags); err != nil {
+			return nil, err
+		}
+	}
+	cfg.envFiles = loaded
+	return cfg, nil
+}
+
+// apiKey finds the API key for cfg: from api_key_command, then
+// api_key_file, then the provider's environment variable.
+func (cfg ProviderConfig) apiKey(keyEnv string) (string, error) {
+	switch {
+	case cfg.APIKey != "":
+		return cfg.APIKey, nil
+	case cfg.APIKeyCommand != "":
+		return runCredentialCommand(cfg.APIKeyCommand)
+	case cfg.APIKeyFile != "":
+		data, err := os.ReadFile(cfg.APIKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read API key file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case keyEnv != "":
+		return os.Getenv(keyEnv), nil
+	}
+	return "", nil
+}
+
+// runCredentialCommand runs command with the shell and returns its output,
+// such as "op read op://dev/openai/key" or "pass show openai".
+func runCredentialCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("API key command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	key := strings.TrimSpace(string(out))
+	if key == "" {
+		return "", errors.New("API key command printed nothing")
+	}
+	return key, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// fakeCompleter answers every request locally so the whole pipeline can be
+// exercised without network access or an API key.
+type fakeCompleter struct {
+	model string
+}
+
+func newFakeCompleter(cfg ProviderConfig) (Completer, error) {
+	return &fakeCompleter{model: cfg.Model}, nil
+}
+
+func (c *fakeCompleter) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	if err := ctx.Err(); err != nil {
+		return Completion{}, err
+	}
+	firstLine, _, _ := strings.Cut(req.Prompt, "\n")
+	sum := sha256.Sum256([]byte(req.Prompt))
+	if req.Schema != nil {
+		var schema map[string]any
+		if err := json.Unmarshal(req.Schema, &schema); err != nil {
+			return Completion{}, fmt.Errorf("invalid schema: %w", err)
+		}
+		defs, _ := schema["$defs"].(map[string]any)
+		data, err := json.Marshal(fakeValue(schema, defs, fmt.Sprintf("fake %x", sum[:6])))
+		if err != nil {
+			return Completion{}, err
+		}
+		return Completion{Content: string(data)}, nil
+	}
+	return Completion{
+		Content: fmt.Sprintf(
+			"Fake response from %s for a %d character prompt (sha256 %x).\n\nPrompt began with: %s\n",
+			c.model, len(req.Prompt), sum[:6], firstLine,
+		),
+	}, nil
+}
+
+// fakeValue builds the smallest value that satisfies schema: one item in
+// every array and the first choice of every enum.
+func fakeValue(schema, defs map[string]any, text string) any {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, _ := defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		return fakeValue(def, defs, text)
+	}
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	switch schema["type"] {
+	case "object":
+		object := make(map[string]any)
+		properties, _ := schema["properties"].(map[string]any)
+		for name, property := range properties {
+			property, _ := property.(map[string]any)
+			object[name] = fakeValue(property, defs, text)
+		}
+		return object
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		return []any{fakeValue(items, defs, text)}
+	case "integer", "number":
+		return 1
+	case "boolean":
+		return true
+	default:
+		return text
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen matches what http.DetectContentType considers.
+const sniffLen = 512
+
+// Truncation strategies for files over the size limit.
+const (
+	truncateHeadTail = "headtail"
+	truncateHead     = "head"
+	truncateSkip     = "skip"
+)
+
+type fileLimits struct {
+	maxSize  int64
+	truncate string
+}
+
+func validTruncateStrategy(s string) bool {
+	return s == truncateHeadTail || s == truncateHead || s == truncateSkip
+}
+
+func isBinary(sample []byte) bool {
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	return !strings.HasPrefix(http.DetectContentType(sample), "text/")
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
+
+func truncationMarker(omitted int64) string {
+	return fmt.Sprintf("\n... [truncated %s] ...\n", formatSize(omitted))
+}
+
+// readFileContent reads a file for inclusion in prompts. Binary files are
+// not returned at all, and files over limits.maxSize are cut down according
+// to limits.truncate without reading them in full. note explains anything
+// that was left out; it is empty when the whole file was read.
+func readFileContent(path string, size int64, limits fileLimits) (content, note string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	sample := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", "", err
+	}
+	if n > 0 && isBinary(sample[:n]) {
+		return "", "omitted: binary", nil
+	}
+
+	if limits.maxSize <= 0 || size <= limits.maxSize {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", "", err
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return "", "", err
+		}
+		return string(data), "", nil
+	}
+	return truncateContent(f, size, limits)
+}
+
+// limitContent applies the same rules as readFileContent to content that is
+// already in memory, such as a patch.
+func limitContent(content string, limits fileLimits) (string, string) {
+	if content != "" && isBinary([]byte(content[:min(len(content), sniffLen)])) {
+		return "", "omitted: binary"
+	}
+	size := int64(len(content))
+	if limits.maxSize <= 0 || size <= limits.maxSize {
+		return content, ""
+	}
+	// Reading from memory cannot fail.
+	content, note, _ := truncateContent(strings.NewReader(content), size, limits)
+	return content, note
+}
+
+// truncateContent cuts r, of size bytes, down to limits.maxSize according to
+// limits.truncate, reading only the parts it keeps.
+func truncateContent(r io.ReaderAt, size int64, limits fileLimits) (content, note string, err error) {
+	switch limits.truncate {
+	case truncateSkip:
+		return "", fmt.Sprintf("omitted: %s exceeds the %s limit", formatSize(size), formatSize(limits.maxSize)), nil
+	case truncateHead:
+		head := make([]byte, limits.maxSize)
+		if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+			return "", "", err
+		}
+		head = trimToLines(head, true)
+		note := fmt.Sprintf("truncated: kept the first %s of %s", formatSize(int64(len(head))), formatSize(size))
+		return string(head) + truncationMarker(size-int64(len(head))), note, nil
+	default:
+		half := limits.maxSize / 2
+		head := make([]byte, half)
+		if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+			return "", "", err
+		}
+		tail := make([]byte, half)
+		if _, err := r.ReadAt(tail, size-half); err != nil && err != io.EOF {
+			return "", "", err
+		}
+		head, tail = trimToLines(head, true), trimToLines(tail, false)
+		note := fmt.Sprintf("truncated: kept the first %s and last %s of %s", formatSize(int64(len(head))), formatSize(int64(len(tail))), formatSize(size))
+		return string(head) + truncationMarker(size-int64(len(head)+len(tail))) + string(tail), note, nil
+	}
+}
+
+// trimToLines drops the partial line at the end of a head excerpt, or at the
+// start of a tail excerpt, so truncated files never end mid-line or mid-rune.
+func trimToLines(b []byte, head bool) []byte {
+	if head {
+		if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+			return b[:i+1]
+		}
+	} else if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[i+1:]
+	}
+	return []byte(strings.ToValidUTF8(string(b), ""))
+}
+
+// annotateFiles renders file paths for prompts, noting why any file's
+// content is missing or incomplete.
+func annotateFiles(files []string, notes map[string]string) []string {
+	annotated := make([]string, len(files))
+	for i, file := range files {
+		annotated[i] = file
+		if note, ok := notes[file]; ok {
+			annotated[i] = fmt.Sprintf("%s (%s)", file, note)
+		}
+	}
+	return annotated
+}
+
+// writeFile replaces name with data atomically, so an interrupted or killed
+// run leaves either the old file or the new one, never a truncated file.
+func writeFile(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
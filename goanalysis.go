@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type GoPackage struct {
+	ImportPath string       `json:"import_path"`
+	Dir        string       `json:"dir"`
+	Name       string       `json:"name"`
+	Doc        string       `json:"doc,omitempty"`
+	Files      []string     `json:"files"`
+	Imports    []string     `json:"imports,omitempty"`
+	Types      []GoType     `json:"types,omitempty"`
+	Functions  []GoFunction `json:"functions,omitempty"`
+}
+
+type GoType struct {
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind"`
+	Doc        string   `json:"doc,omitempty"`
+	Methods    []string `json:"methods,omitempty"`
+	Implements []string `json:"implements,omitempty"`
+}
+
+type GoFunction struct {
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+}
+
+var goModulePath = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+
+var goBuildIgnore = regexp.MustCompile(`(?m)^//go:build ignore$`)
+
+type goSourcePackage struct {
+	dir        string
+	importPath string
+	name       string
+	files      []*ast.File
+	fileNames  []string
+	types      *types.Package
+}
+
+// analyzeGoPackages parses and type-checks the Go packages in code without
+// touching the network or the module cache: packages in the repository are
+// checked against each other, the standard library is loaded from GOROOT,
+// and other imports are left unresolved.
+func analyzeGoPackages(projectName string, code map[string]string) []GoPackage {
+	modulePath := projectName
+	if m := goModulePath.FindStringSubmatch(code["go.mod"]); m != nil {
+		modulePath = m[1]
+	}
+
+	fset := token.NewFileSet()
+	byDir := make(map[string]*goSourcePackage)
+	for _, file := range sortedKeys(code) {
+		slashed := filepath.ToSlash(file)
+		if !strings.HasSuffix(slashed, ".go") || strings.HasSuffix(slashed, "_test.go") {
+			continue
+		}
+		if vendoredPath.MatchString(slashed) || strings.Contains("/"+slashed, "/testdata/") {
+			continue
+		}
+		if goBuildIgnore.MatchString(code[file]) {
+			continue
+		}
+		// Truncated or otherwise broken files still yield a partial AST.
+		f, _ := parser.ParseFile(fset, slashed, code[file], parser.ParseComments|parser.SkipObjectResolution)
+		if f == nil || f.Name == nil {
+			continue
+		}
+
+		dir := path.Dir(slashed)
+		pkg, ok := byDir[dir]
+		if !ok {
+			importPath := modulePath
+			if dir != "." {
+				importPath = modulePath + "/" + dir
+			}
+			pkg = &goSourcePackage{dir: dir, importPath: importPath, name: f.Name.Name}
+			byDir[dir] = pkg
+		}
+		if f.Name.Name != pkg.name {
+			continue
+		}
+		pkg.files = append(pkg.files, f)
+		pkg.fileNames = append(pkg.fileNames, slashed)
+	}
+	if len(byDir) == 0 {
+		return nil
+	}
+
+	byImportPath := make(map[string]*goSourcePackage)
+	for _, pkg := range byDir {
+		byImportPath[pkg.importPath] = pkg
+	}
+	imp := &goImporter{fset: fset, local: byImportPath, std: importer.ForCompiler(fset, "source", nil), checking: make(map[string]bool)}
+	for _, pkg := range byDir {
+		imp.check(pkg)
+	}
+
+	interfaces := localInterfaces(byDir)
+
+	var packages []GoPackage
+	for _, dir := range sortedPackageDirs(byDir) {
+		packages = append(packages, describeGoPackage(fset, byDir[dir], interfaces))
+	}
+	return packages
+}
+
+func sortedPackageDirs(byDir map[string]*goSourcePackage) []string {
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+type goImporter struct {
+	fset     *token.FileSet
+	local    map[string]*goSourcePackage
+	std      types.Importer
+	checking map[string]bool
+	external map[string]*types.Package
+}
+
+func (imp *goImporter) Import(importPath string) (*types.Package, error) {
+	if pkg, ok := imp.local[importPath]; ok {
+		if imp.checking[importPath] {
+			return nil, fmt.Errorf("import cycle through %s", importPath)
+		}
+		return imp.check(pkg), nil
+	}
+
+	first, _, _ := strings.Cut(importPath, "/")
+	if !strings.Contains(first, ".") {
+		if pkg, err := imp.std.Import(importPath); err == nil {
+			return pkg, nil
+		}
+	}
+
+	// Unknown third-party package: an empty stand-in lets checking carry
+	// on, with anything that uses it typed as invalid.
+	if imp.external == nil {
+		imp.external = make(map[string]*types.Package)
+	}
+	if pkg, ok := imp.external[importPath]; ok {
+		return pkg, nil
+	}
+	pkg := types.NewPackage(importPath, path.Base(importPath))
+	pkg.MarkComplete()
+	imp.external[importPath] = pkg
+	return pkg, nil
+}
+
+func (imp *goImporter) check(pkg *goSourcePackage) *types.Package {
+	if pkg.types != nil {
+		return pkg.types
+	}
+	imp.checking[pkg.importPath] = true
+	defer delete(imp.checking, pkg.importPath)
+
+	conf := types.Config{
+		Importer:    imp,
+		Error:       func(error) {},
+		FakeImportC: true,
+	}
+	// Type errors are expected when dependencies cannot be resolved; the
+	// package is still returned with everything that could be checked.
+	pkg.types, _ = conf.Check(pkg.importPath, imp.fset, pkg.files, nil)
+	return pkg.types
+}
+
+type goInterface struct {
+	name  string
+	iface *types.Interface
+}
+
+func localInterfaces(byDir map[string]*goSourcePackage) []goInterface {
+	var interfaces []goInterface
+	for _, dir := range sortedPackageDirs(byDir) {
+		pkg := byDir[dir]
+		if pkg.types == nil {
+			continue
+		}
+		scope := pkg.types.Scope()
+		for _, name := range scope.Names() {
+			obj, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			iface, ok := obj.Type().Underlying().(*types.Interface)
+			if !ok || iface.NumMethods() == 0 {
+				continue
+			}
+			interfaces = append(interfaces, goInterface{name: pkg.importPath + "." + name, iface: iface})
+		}
+	}
+	return interfaces
+}
+
+func describeGoPackage(fset *token.FileSet, pkg *goSourcePackage, interfaces []goInterface) GoPackage {
+	// Nothing in a main package can be imported, so its unexported
+	// declarations are the interesting ones.
+	mode := doc.PreserveAST
+	if pkg.name == "main" {
+		mode |= doc.AllDecls
+	}
+	docs, err := doc.NewFromFiles(fset, pkg.files, pkg.importPath, mode)
+
+	out := GoPackage{
+		ImportPath: pkg.importPath,
+		Dir:        pkg.dir,
+		Name:       pkg.name,
+		Files:      pkg.fileNames,
+	}
+
+	imports := make(map[string]bool)
+	for _, f := range pkg.files {
+		for _, spec := range f.Imports {
+			imports[strings.Trim(spec.Path.Value, `"`)] = true
+		}
+	}
+	for importPath := range imports {
+		out.Imports = append(out.Imports, importPath)
+	}
+	sort.Strings(out.Imports)
+
+	if err != nil {
+		return out
+	}
+	out.Doc = docs.Synopsis(docs.Doc)
+
+	for _, t := range docs.Types {
+		out.Types = append(out.Types, describeGoType(fset, pkg, t, interfaces))
+		for _, fn := range t.Funcs {
+			out.Functions = append(out.Functions, describeGoFunc(fset, fn))
+		}
+	}
+	for _, fn := range docs.Funcs {
+		out.Functions = append(out.Functions, describeGoFunc(fset, fn))
+	}
+	return out
+}
+
+func describeGoType(fset *token.FileSet, pkg *goSourcePackage, t *doc.Type, interfaces []goInterface) GoType {
+	out := GoType{Name: t.Name, Kind: "type", Doc: firstParagraph(t.Doc)}
+
+	var spec *ast.TypeSpec
+	for _, s := range t.Decl.Specs {
+		if ts, ok := s.(*ast.TypeSpec); ok && ts.Name.Name == t.Name {
+			spec = ts
+		}
+	}
+	if spec != nil {
+		switch typ := spec.Type.(type) {
+		case *ast.StructType:
+			out.Kind = "struct"
+		case *ast.InterfaceType:
+			out.Kind = "interface"
+			for _, field := range typ.Methods.List {
+				signature := strings.TrimPrefix(nodeString(fset, field.Type), "func")
+				for _, name := range field.Names {
+					out.Methods = append(out.Methods, name.Name+signature)
+				}
+				if len(field.Names) == 0 {
+					out.Methods = append(out.Methods, signature)
+				}
+			}
+		}
+		if spec.Assign.IsValid() {
+			out.Kind = "alias"
+		}
+	}
+	for _, fn := range t.Methods {
+		out.Methods = append(out.Methods, describeGoFunc(fset, fn).Signature)
+	}
+
+	if pkg.types == nil || out.Kind == "interface" {
+		return out
+	}
+	obj, ok := pkg.types.Scope().Lookup(t.Name).(*types.TypeName)
+	if !ok {
+		return out
+	}
+	for _, iface := range interfaces {
+		if types.Implements(obj.Type(), iface.iface) || types.Implements(types.NewPointer(obj.Type()), iface.iface) {
+			name := iface.name
+			if strings.HasPrefix(name, pkg.importPath+".") {
+				name = strings.TrimPrefix(name, pkg.importPath+".")
+			}
+			out.Implements = append(out.Implements, name)
+		}
+	}
+	return out
+}
+
+func describeGoFunc(fset *token.FileSet, fn *doc.Func) GoFunction {
+	decl := *fn.Decl
+	decl.Doc = nil
+	decl.Body = nil
+	return GoFunction{Signature: nodeString(fset, &decl), Doc: firstParagraph(fn.Doc)}
+}
+
+func nodeString(fset *token.FileSet, node any) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+func firstParagraph(text string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(text), "\n\n")
+	return strings.Join(strings.Fields(first), " ")
+}
+
+// formatGoPackage renders a package summary as compact text for prompts.
+func formatGoPackage(pkg GoPackage) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Go package %s (%s), files: %s\n", pkg.Name, pkg.ImportPath, strings.Join(pkg.Files, ", "))
+	if pkg.Doc != "" {
+		fmt.Fprintf(&b, "%s\n", pkg.Doc)
+	}
+	if len(pkg.Imports) > 0 {
+		fmt.Fprintf(&b, "Imports: %s\n", strings.Join(pkg.Imports, ", "))
+	}
+	for _, t := range pkg.Types {
+		fmt.Fprintf(&b, "type %s %s", t.Name, t.Kind)
+		if len(t.Implements) > 0 {
+			fmt.Fprintf(&b, " (implements %s)", strings.Join(t.Implements, ", "))
+		}
+		if t.Doc != "" {
+			fmt.Fprintf(&b, ": %s", t.Doc)
+		}
+		b.WriteString("\n")
+		for _, method := range t.Methods {
+			fmt.Fprintf(&b, "    %s\n", method)
+		}
+	}
+	for _, fn := range pkg.Functions {
+		fmt.Fprintf(&b, "%s", fn.Signature)
+		if fn.Doc != "" {
+			fmt.Fprintf(&b, ": %s", fn.Doc)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatGoPackages renders pkgs for prompts in at most maxTokens: full
+// summaries while they fit, then one line per package, then a count of the
+// packages left out.
+func formatGoPackages(pkgs []GoPackage, maxTokens int) string {
+	var blocks []string
+	used := 0
+	for i, pkg := range pkgs {
+		block := formatGoPackage(pkg)
+		if used+estimateTokens(block) > maxTokens {
+			block = fmt.Sprintf("Go package %s (%s), files: %s\n", pkg.Name, pkg.ImportPath, strings.Join(pkg.Files, ", "))
+		}
+		if used+estimateTokens(block) > maxTokens {
+			blocks = append(blocks, fmt.Sprintf("... %d more packages omitted\n", len(pkgs)-i))
+			break
+		}
+		used += estimateTokens(block)
+		blocks = append(blocks, block)
+	}
+	return strings.Join(blocks, "")
+}
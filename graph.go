@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DependencyGraph links the repository's packages, one node per directory
+// of source files, by the imports between them. Imports of anything outside
+// the repository are left out.
+type DependencyGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID        string   `json:"id"`
+	Languages []string `json:"languages"`
+	Files     int      `json:"files"`
+}
+
+type GraphEdge struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Imports int    `json:"imports"`
+}
+
+var (
+	jsExtensions = []string{".ts", ".tsx", ".mts", ".js", ".jsx", ".mjs", ".cjs"}
+	rustRoots    = []string{"lib.rs", "main.rs"}
+)
+
+// importResolver maps import strings found in source files to the
+// repository files they refer to.
+type importResolver struct {
+	files        map[string]bool
+	pythonModule map[string]string
+	javaClass    map[string]string
+	javaPackage  map[string]string
+	byBase       map[string][]string
+}
+
+func newImportResolver(files []string, symbols map[string][]Symbol) *importResolver {
+	r := &importResolver{
+		files:        make(map[string]bool),
+		pythonModule: make(map[string]string),
+		javaClass:    make(map[string]string),
+		javaPackage:  make(map[string]string),
+		byBase:       make(map[string][]string),
+	}
+	for _, file := range files {
+		file = filepath.ToSlash(file)
+		r.files[file] = true
+		r.byBase[path.Base(file)] = append(r.byBase[path.Base(file)], file)
+
+		switch path.Ext(file) {
+		case ".py", ".pyi":
+			module := pythonModuleName(file)
+			r.pythonModule[module] = file
+			// src layout: the package is imported without the src prefix.
+			if rest, ok := strings.CutPrefix(module, "src."); ok {
+				r.pythonModule[rest] = file
+			}
+		case ".java":
+			for _, s := range symbols[file] {
+				if s.Kind == "module" {
+					r.javaPackage[s.Name] = path.Dir(file)
+					r.javaClass[s.Name+"."+strings.TrimSuffix(path.Base(file), ".java")] = file
+				}
+			}
+		}
+	}
+	return r
+}
+
+// resolve returns the repository file, or for Java wildcard imports the
+// directory, that the import spec in file refers to.
+func (r *importResolver) resolve(file string, s Symbol) (string, bool) {
+	dir := path.Dir(file)
+	spec := s.Name
+	switch path.Ext(file) {
+	case ".py", ".pyi":
+		return r.resolvePython(file, spec)
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".mts", ".tsx":
+		if !strings.HasPrefix(spec, ".") {
+			return "", false
+		}
+		target := path.Join(dir, spec)
+		for _, candidate := range append([]string{target}, jsCandidates(target)...) {
+			if r.files[candidate] {
+				return candidate, true
+			}
+		}
+	case ".rs":
+		return r.resolveRust(file, s)
+	case ".java":
+		if target, ok := r.javaClass[spec]; ok {
+			return target, true
+		}
+		if target, ok := r.javaPackage[spec]; ok {
+			return target + "/", true
+		}
+	case ".c", ".h":
+		for _, candidate := range []string{path.Join(dir, spec), path.Clean(spec)} {
+			if r.files[candidate] {
+				return candidate, true
+			}
+		}
+		// Include paths are not known, so fall back to a unique file name.
+		if matches := r.byBase[path.Base(spec)]; len(matches) == 1 && strings.HasSuffix("/"+matches[0], "/"+spec) {
+			return matches[0], true
+		}
+	}
+	return "", false
+}
+
+func jsCandidates(target string) []string {
+	var candidates []string
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, target+ext)
+	}
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, target+"/index"+ext)
+	}
+	return candidates
+}
+
+func (r *importResolver) resolvePython(file, spec string) (string, bool) {
+	module := spec
+	if strings.HasPrefix(spec, ".") {
+		rest := strings.TrimLeft(spec, ".")
+		// One dot is the current package; each further dot goes up one.
+		pkg := strings.Split(pythonModuleName(file), ".")
+		if path.Base(strings.TrimSuffix(file, path.Ext(file))) != "__init__" {
+			pkg = pkg[:len(pkg)-1]
+		}
+		up := len(spec) - len(rest) - 1
+		if up > len(pkg) {
+			return "", false
+		}
+		parts := pkg[:len(pkg)-up]
+		if rest != "" {
+			parts = append(parts, rest)
+		}
+		module = strings.Join(parts, ".")
+	}
+	// "from a.b import c" names a.b; "import a.b.c" may name a module or,
+	// when c is an attribute, a.b.
+	for ; module != ""; module = trimLastComponent(module, ".") {
+		if target, ok := r.pythonModule[module]; ok {
+			return target, true
+		}
+		if target, ok := r.pythonModule["src."+module]; ok {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+func (r *importResolver) resolveRust(file string, s Symbol) (string, bool) {
+	// "mod foo;" loads foo.rs or foo/mod.rs next to a crate root or mod.rs,
+	// and under a directory named after any other module file.
+	if s.Kind == "module" {
+		dir := path.Dir(file)
+		if base := path.Base(file); base != "mod.rs" && !slices.Contains(rustRoots, base) {
+			dir = strings.TrimSuffix(file, ".rs")
+		}
+		return r.rustModule(dir, s.Name)
+	}
+
+	rest, ok := strings.CutPrefix(s.Name, "crate::")
+	if !ok {
+		return "", false
+	}
+	root := r.rustCrateRoot(path.Dir(file))
+	if root == "" {
+		return "", false
+	}
+	target, found := "", false
+	dir := root
+	for _, segment := range strings.Split(rest, "::") {
+		next, ok := r.rustModule(dir, strings.Trim(segment, "{} "))
+		if !ok {
+			break
+		}
+		target, found = next, true
+		dir = strings.TrimSuffix(strings.TrimSuffix(next, "/mod.rs"), ".rs")
+	}
+	return target, found
+}
+
+func (r *importResolver) rustModule(dir, name string) (string, bool) {
+	for _, candidate := range []string{path.Join(dir, name+".rs"), path.Join(dir, name, "mod.rs")} {
+		if r.files[candidate] {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func (r *importResolver) rustCrateRoot(dir string) string {
+	for {
+		for _, root := range rustRoots {
+			if r.files[path.Join(dir, root)] {
+				return dir
+			}
+		}
+		if dir == "." || dir == "/" {
+			return ""
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+func trimLastComponent(s, sep string) string {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return ""
+	}
+	return s[:i]
+}
+
+// buildDependencyGraph builds the package graph from the Go package
+// analysis and the imports found by the symbol extractor.
+func buildDependencyGraph(files []string, goPackages []GoPackage, symbols map[string][]Symbol) *DependencyGraph {
+	languages := make(map[string]map[string]bool)
+	fileCounts := make(map[string]int)
+	addNode := func(dir, lang string, files int) {
+		if languages[dir] == nil {
+			languages[dir] = make(map[string]bool)
+		}
+		languages[dir][lang] = true
+		fileCounts[dir] += files
+	}
+
+	edges := make(map[[2]string]int)
+	addEdge := func(from, to string) {
+		if from != to {
+			edges[[2]string{from, to}]++
+		}
+	}
+
+	goDirs := make(map[string]string)
+	for _, pkg := range goPackages {
+		goDirs[pkg.ImportPath] = pkg.Dir
+		addNode(pkg.Dir, "Go", len(pkg.Files))
+	}
+	for _, pkg := range goPackages {
+		for _, importPath := range pkg.Imports {
+			if dir, ok := goDirs[importPath]; ok {
+				addEdge(pkg.Dir, dir)
+			}
+		}
+	}
+
+	resolver := newImportResolver(files, symbols)
+	for _, file := range sortedKeys(symbols) {
+		lang, _ := classifyFile(file, "")
+		addNode(path.Dir(file), lang.name, 1)
+	}
+	for _, file := range sortedKeys(symbols) {
+		for _, s := range symbols[file] {
+			if s.Kind != "import" && !(s.Kind == "module" && path.Ext(file) == ".rs") {
+				continue
+			}
+			target, ok := resolver.resolve(file, s)
+			if !ok {
+				continue
+			}
+			to := strings.TrimSuffix(target, "/")
+			if !strings.HasSuffix(target, "/") {
+				to = path.Dir(target)
+			}
+			if _, ok := languages[to]; ok {
+				addEdge(path.Dir(file), to)
+			}
+		}
+	}
+
+	graph := &DependencyGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, dir := range sortedKeys(languages) {
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: dir, Languages: sortedKeys(languages[dir]), Files: fileCounts[dir]})
+	}
+	for edge, count := range edges {
+		graph.Edges = append(graph.Edges, GraphEdge{From: edge[0], To: edge[1], Imports: count})
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	return graph
+}
+
+func graphLabel(id string) string {
+	if id == "." {
+		return "root"
+	}
+	return id
+}
+
+func (g *DependencyGraph) dot() string {
+	var b strings.Builder
+	b.WriteString("digraph dependencies {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "\t%q [label=%q];\n", node.ID, graphLabel(node.ID)+"\n"+strings.Join(node.Languages, ", "))
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "\t%q -> %q [label=\"%d\"];\n", edge.From, edge.To, edge.Imports)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (g *DependencyGraph) mermaid() string {
+	ids := make(map[string]string)
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for i, node := range g.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "    n%d[\"%s\"]\n", i, strings.ReplaceAll(graphLabel(node.ID), `"`, "#quot;"))
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "    %s --> %s\n", ids[edge.From], ids[edge.To])
+	}
+	return b.String()
+}
+
+// writeDependencyGraph writes the graph as JSON, Graphviz DOT and Mermaid to
+// outputDir.
+func writeDependencyGraph(outputDir string, graph *DependencyGraph) error {
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(outputDir, "dependency_graph.json"), data); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(outputDir, "dependency_graph.dot"), []byte(graph.dot())); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(outputDir, "dependency_graph.mmd"), []byte(graph.mermaid())); err != nil {
+		return err
+	}
+	progressf("Dependency graph with %d packages and %d edges written to %s\n", len(graph.Nodes), len(graph.Edges), filepath.Join(outputDir, "dependency_graph.{json,dot,mmd}"))
+	return nil
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// describeIgnoreFile lists files that git tracks but that should never be
+// sent to the model. It uses .gitignore syntax and may appear in any
+// directory.
+const describeIgnoreFile = ".describeignore"
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreFile is one parsed ignore file. Its patterns are relative to base,
+// a slash separated directory relative to the repository root.
+type ignoreFile struct {
+	base     string
+	patterns []ignorePattern
+}
+
+// compileIgnorePattern converts one line of a gitignore file into a pattern,
+// following the rules in gitignore(5). ok is false for blank lines and
+// comments.
+func compileIgnorePattern(line string) (p ignorePattern, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || line[0] == '#' {
+		return p, false
+	}
+
+	// Trailing spaces are ignored unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" {
+		return p, false
+	}
+
+	if line[0] == '!' {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to the
+	// directory of the ignore file; otherwise it matches at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return p, false
+	}
+	p.re = re
+	return p, true
+}
+
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				atStart := i == 0 || glob[i-1] == '/'
+				atEnd := i+2 == len(glob)
+				switch {
+				case atStart && atEnd:
+					b.WriteString(".*")
+					i++
+					continue
+				case atStart && glob[i+2] == '/':
+					b.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+			}
+			for i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+func readIgnoreFile(file, base string) (*ignoreFile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	ignore := &ignoreFile{base: base}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := compileIgnorePattern(scanner.Text()); ok {
+			ignore.patterns = append(ignore.patterns, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ignore, nil
+}
+
+// match reports whether any pattern in f decides rel, and if so whether it
+// is ignored. As in git, the last matching pattern wins.
+func (f *ignoreFile) match(rel string, isDir bool) (decided, ignored bool) {
+	if f.base != "." {
+		rel = strings.TrimPrefix(rel, f.base+"/")
+	}
+	for i := len(f.patterns) - 1; i >= 0; i-- {
+		p := f.patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(rel) {
+			return true, !p.negate
+		}
+	}
+	return false, false
+}
+
+// ignoreMatcher applies one kind of per-directory ignore file (such as
+// .gitignore) across a repository, plus any repository-wide exclude files.
+type ignoreMatcher struct {
+	root   string
+	name   string
+	global []*ignoreFile
+	dirs   map[string]*ignoreFile
+}
+
+func newIgnoreMatcher(root, name string, global []*ignoreFile) *ignoreMatcher {
+	return &ignoreMatcher{root: root, name: name, global: global, dirs: make(map[string]*ignoreFile)}
+}
+
+func (m *ignoreMatcher) load(dir string) (*ignoreFile, error) {
+	if f, ok := m.dirs[dir]; ok {
+		return f, nil
+	}
+	f, err := readIgnoreFile(filepath.Join(m.root, filepath.FromSlash(dir), m.name), dir)
+	if err != nil {
+		return nil, err
+	}
+	m.dirs[dir] = f
+	return f, nil
+}
+
+// match reports whether rel, a slash separated path relative to the root,
+// is ignored. Ignore files in deeper directories take precedence over those
+// above them, and all of them over the global excludes. Parent directories
+// are not checked; see repoIgnore.ignoredPath.
+func (m *ignoreMatcher) match(rel string, isDir bool) (bool, error) {
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		f, err := m.load(dir)
+		if err != nil {
+			return false, err
+		}
+		if f != nil {
+			if decided, ignored := f.match(rel, isDir); decided {
+				return ignored, nil
+			}
+		}
+		if dir == "." {
+			break
+		}
+	}
+
+	for _, f := range m.global {
+		if decided, ignored := f.match(rel, isDir); decided {
+			return ignored, nil
+		}
+	}
+	return false, nil
+}
+
+// repoIgnore combines git's ignore rules with .describeignore files. A path
+// is skipped if either excludes it.
+type repoIgnore struct {
+	git      *ignoreMatcher
+	describe *ignoreMatcher
+	// exclude and include hold patterns given on the command line.
+	exclude *ignoreFile
+	include *ignoreFile
+}
+
+// loadIgnore collects the ignore rules git would apply to the repository at
+// root: per-directory .gitignore files, .git/info/exclude and the user's
+// core.excludesFile.
+func loadIgnore(ctx context.Context, root string) (*repoIgnore, error) {
+	var global []*ignoreFile
+	for _, file := range []string{filepath.Join(root, ".git", "info", "exclude"), globalExcludesFile(ctx, root)} {
+		if file == "" {
+			continue
+		}
+		f, err := readIgnoreFile(file, ".")
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			global = append(global, f)
+		}
+	}
+
+	return &repoIgnore{
+		git:      newIgnoreMatcher(root, ".gitignore", global),
+		describe: newIgnoreMatcher(root, describeIgnoreFile, nil),
+	}, nil
+}
+
+func globalExcludesFile(ctx context.Context, root string) string {
+	if out, err := git(ctx, root, "config", "--path", "--get", "core.excludesFile"); err == nil {
+		if file := strings.TrimSpace(out); file != "" {
+			return file
+		}
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// addPatterns adds gitignore-style patterns relative to the repository
+// root. Excludes take precedence over every ignore file. Includes, if there
+// are any, keep only the files they match or that sit in a directory they
+// match.
+func (r *repoIgnore) addPatterns(include, exclude []string) {
+	compile := func(lines []string) *ignoreFile {
+		f := &ignoreFile{base: "."}
+		for _, line := range lines {
+			if p, ok := compileIgnorePattern(line); ok {
+				f.patterns = append(f.patterns, p)
+			}
+		}
+		if len(f.patterns) == 0 {
+			return nil
+		}
+		return f
+	}
+	r.include, r.exclude = compile(include), compile(exclude)
+}
+
+func (r *repoIgnore) included(rel string) bool {
+	if r.include == nil {
+		return true
+	}
+	// The deepest match decides, so "src/" keeps everything under src
+	// unless a pattern for the file itself says otherwise.
+	parts := strings.Split(rel, "/")
+	for i := len(parts); i > 0; i-- {
+		if decided, matched := r.include.match(strings.Join(parts[:i], "/"), i < len(parts)); decided {
+			return matched
+		}
+	}
+	return false
+}
+
+// ignored reports whether rel should be skipped, assuming its parent
+// directories have already been checked, as they are during a walk.
+func (r *repoIgnore) ignored(rel string, isDir bool) (bool, error) {
+	rel = filepath.ToSlash(rel)
+	if r.exclude != nil {
+		if decided, ignored := r.exclude.match(rel, isDir); decided {
+			return ignored, nil
+		}
+	}
+	if !isDir && !r.included(rel) {
+		return true, nil
+	}
+	if ignored, err := r.git.match(rel, isDir); err != nil || ignored {
+		return ignored, err
+	}
+	return r.describe.match(rel, isDir)
+}
+
+// ignoredPath is like ignored but also checks every parent directory of
+// rel, for paths that did not come from a walk.
+func (r *repoIgnore) ignoredPath(rel string) (bool, error) {
+	rel = filepath.ToSlash(rel)
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if ignored, err := r.ignored(strings.Join(parts[:i], "/"), true); err != nil || ignored {
+			return ignored, err
+		}
+	}
+	return r.ignored(rel, false)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileIgnorePatternSkips(t *testing.T) {
+	for _, line := range []string{"", "# comment", "   ", "/", "!", "\r"} {
+		if _, ok := compileIgnorePattern(line); ok {
+			t.Errorf("compileIgnorePattern(%q) is a pattern, want none", line)
+		}
+	}
+}
+
+func TestCompileIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "app.log", false, true},
+		{"*.log", "a/b/app.log", false, true},
+		{"*.log", "app.log.txt", false, false},
+		{"/root.txt", "root.txt", false, true},
+		{"/root.txt", "a/root.txt", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"a/*.go", "a/x.go", false, true},
+		{"a/*.go", "a/b/x.go", false, false},
+		{"**/tmp", "x/y/tmp", true, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"docs/**", "docs/x/y.md", false, true},
+		{"foo?.txt", "foo1.txt", false, true},
+		{"foo?.txt", "foo12.txt", false, false},
+		{"[abc].c", "b.c", false, true},
+		{"[abc].c", "d.c", false, false},
+		{"[!x]y.go", "zy.go", false, true},
+		{"[!x]y.go", "xy.go", false, false},
+		{`\#hash`, "#hash", false, true},
+		{`\!bang`, "!bang", false, true},
+		{"trailing   ", "trailing", false, true},
+		{`space\ `, "space ", false, true},
+		{"a+b(c).txt", "a+b(c).txt", false, true},
+	}
+	for _, tt := range tests {
+		p, ok := compileIgnorePattern(tt.pattern)
+		if !ok {
+			t.Errorf("compileIgnorePattern(%q) is not a pattern", tt.pattern)
+			continue
+		}
+		f := &ignoreFile{base: ".", patterns: []ignorePattern{p}}
+		if _, got := f.match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("%q matching %q (dir %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+// TestIgnoreMatchesGit checks a repository's ignore rules against what git
+// check-ignore says about the same files.
+func TestIgnoreMatchesGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore": strings.Join([]string{
+			"*.log", "!keep.log", "/root.txt", "build/", "docs/**/*.md", "**/tmp",
+			"a/**/b", "foo?.txt", "[abc].c", "[!x]y.go", `\#hash`, "sub/deep.txt",
+			"ignored-dir/", "!ignored-dir/back.txt",
+		}, "\n") + "\n",
+		"pkg/.gitignore": "*.gen.go\n/local.txt\n!keep.gen.go\n",
+	}
+	paths := []string{
+		"app.log", "keep.log", "x/keep.log", "x/app.log", "root.txt", "x/root.txt",
+		"build/out.o", "x/build/out.o", "build.txt", "docs/a.md", "docs/x/y/b.md",
+		"docs/a.txt", "tmp/z", "x/tmp/z", "a/b", "a/x/y/b", "x/a/b", "foo1.txt",
+		"foo12.txt", "a.c", "d.c", "zy.go", "xy.go", "#hash", "sub/deep.txt",
+		"x/sub/deep.txt", "pkg/a.gen.go", "pkg/keep.gen.go", "pkg/local.txt",
+		"local.txt", "pkg/q/local.txt", "pkg/q/b.gen.go", "ignored-dir/back.txt",
+		"main.go",
+	}
+	for _, path := range paths {
+		files[path] = "x\n"
+	}
+	for path, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	ignore, err := loadIgnore(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		got, err := ignore.ignoredPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// check-ignore exits 0 for ignored paths and 1 for the rest.
+		err = exec.Command("git", "-C", root, "check-ignore", "-q", "--no-index", path).Run()
+		want := err == nil
+		if exit, ok := err.(*exec.ExitError); err != nil && (!ok || exit.ExitCode() != 1) {
+			t.Fatalf("git check-ignore %s: %v", path, err)
+		}
+		if got != want {
+			t.Errorf("%s: ignored = %v, git says %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Language types, as in GitHub linguist. Only programming languages compete
+// for the primary language.
+const (
+	langProgramming = "programming"
+	langMarkup      = "markup"
+	langData        = "data"
+	langProse       = "prose"
+)
+
+type language struct {
+	name string
+	kind string
+}
+
+var extensionLanguages = map[string]language{
+	".go":      {"Go", langProgramming},
+	".py":      {"Python", langProgramming},
+	".pyi":     {"Python", langProgramming},
+	".js":      {"JavaScript", langProgramming},
+	".mjs":     {"JavaScript", langProgramming},
+	".cjs":     {"JavaScript", langProgramming},
+	".jsx":     {"JavaScript", langProgramming},
+	".ts":      {"TypeScript", langProgramming},
+	".mts":     {"TypeScript", langProgramming},
+	".tsx":     {"TSX", langProgramming},
+	".rs":      {"Rust", langProgramming},
+	".java":    {"Java", langProgramming},
+	".kt":      {"Kotlin", langProgramming},
+	".kts":     {"Kotlin", langProgramming},
+	".scala":   {"Scala", langProgramming},
+	".groovy":  {"Groovy", langProgramming},
+	".c":       {"C", langProgramming},
+	".h":       {"C", langProgramming},
+	".cc":      {"C++", langProgramming},
+	".cpp":     {"C++", langProgramming},
+	".cxx":     {"C++", langProgramming},
+	".hpp":     {"C++", langProgramming},
+	".hh":      {"C++", langProgramming},
+	".cs":      {"C#", langProgramming},
+	".fs":      {"F#", langProgramming},
+	".swift":   {"Swift", langProgramming},
+	".m":       {"Objective-C", langProgramming},
+	".mm":      {"Objective-C++", langProgramming},
+	".rb":      {"Ruby", langProgramming},
+	".php":     {"PHP", langProgramming},
+	".pl":      {"Perl", langProgramming},
+	".pm":      {"Perl", langProgramming},
+	".lua":     {"Lua", langProgramming},
+	".r":       {"R", langProgramming},
+	".dart":    {"Dart", langProgramming},
+	".ex":      {"Elixir", langProgramming},
+	".exs":     {"Elixir", langProgramming},
+	".erl":     {"Erlang", langProgramming},
+	".hs":      {"Haskell", langProgramming},
+	".ml":      {"OCaml", langProgramming},
+	".clj":     {"Clojure", langProgramming},
+	".zig":     {"Zig", langProgramming},
+	".nim":     {"Nim", langProgramming},
+	".jl":      {"Julia", langProgramming},
+	".sh":      {"Shell", langProgramming},
+	".bash":    {"Shell", langProgramming},
+	".zsh":     {"Shell", langProgramming},
+	".fish":    {"fish", langProgramming},
+	".ps1":     {"PowerShell", langProgramming},
+	".sql":     {"SQL", langData},
+	".vue":     {"Vue", langMarkup},
+	".svelte":  {"Svelte", langMarkup},
+	".html":    {"HTML", langMarkup},
+	".htm":     {"HTML", langMarkup},
+	".css":     {"CSS", langMarkup},
+	".scss":    {"SCSS", langMarkup},
+	".sass":    {"Sass", langMarkup},
+	".less":    {"Less", langMarkup},
+	".xml":     {"XML", langData},
+	".svg":     {"SVG", langData},
+	".json":    {"JSON", langData},
+	".yaml":    {"YAML", langData},
+	".yml":     {"YAML", langData},
+	".toml":    {"TOML", langData},
+	".ini":     {"INI", langData},
+	".csv":     {"CSV", langData},
+	".proto":   {"Protocol Buffer", langData},
+	".graphql": {"GraphQL", langData},
+	".tf":      {"HCL", langProgramming},
+	".hcl":     {"HCL", langProgramming},
+	".md":      {"Markdown", langProse},
+	".mdx":     {"MDX", langProse},
+	".rst":     {"reStructuredText", langProse},
+	".adoc":    {"AsciiDoc", langProse},
+	".txt":     {"Text", langProse},
+	".tex":     {"TeX", langMarkup},
+}
+
+var filenameLanguages = map[string]language{
+	"Makefile":        {"Makefile", langProgramming},
+	"GNUmakefile":     {"Makefile", langProgramming},
+	"makefile":        {"Makefile", langProgramming},
+	"Dockerfile":      {"Dockerfile", langProgramming},
+	"Containerfile":   {"Dockerfile", langProgramming},
+	"CMakeLists.txt":  {"CMake", langProgramming},
+	"Rakefile":        {"Ruby", langProgramming},
+	"Gemfile":         {"Ruby", langProgramming},
+	"Jenkinsfile":     {"Groovy", langProgramming},
+	"Vagrantfile":     {"Ruby", langProgramming},
+	"BUILD":           {"Starlark", langProgramming},
+	"BUILD.bazel":     {"Starlark", langProgramming},
+	"WORKSPACE":       {"Starlark", langProgramming},
+	"go.mod":          {"Go Module", langData},
+	"go.sum":          {"Go Checksums", langData},
+	".gitignore":      {"Ignore List", langData},
+	".dockerignore":   {"Ignore List", langData},
+	".describeignore": {"Ignore List", langData},
+	"LICENSE":         {"Text", langProse},
+}
+
+var interpreterLanguages = map[string]string{
+	"sh":      "Shell",
+	"bash":    "Shell",
+	"zsh":     "Shell",
+	"dash":    "Shell",
+	"python":  "Python",
+	"python2": "Python",
+	"python3": "Python",
+	"node":    "JavaScript",
+	"deno":    "TypeScript",
+	"ruby":    "Ruby",
+	"perl":    "Perl",
+	"php":     "PHP",
+	"lua":     "Lua",
+	"Rscript": "R",
+}
+
+var vendoredPath = regexp.MustCompile(`(^|/)(vendor|node_modules|third_party|third-party|bower_components|\.yarn|Godeps|dist)/|\.min\.(js|css)$|-min\.js$`)
+
+var generatedPath = regexp.MustCompile(`\.pb\.go$|_pb2(_grpc)?\.py$|\.pb\.(cc|h)$|_generated\.go$|\.g\.dart$|(^|/)(package-lock\.json|yarn\.lock|pnpm-lock\.yaml|Cargo\.lock|poetry\.lock|Gemfile\.lock|composer\.lock|go\.sum)$`)
+
+var generatedMarker = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$|@generated|<auto-generated`)
+
+type LanguageStat struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Files   int     `json:"files"`
+	Bytes   int64   `json:"bytes"`
+	Percent float64 `json:"percent"`
+}
+
+// excludedFromLanguages reports why a file should not count towards the
+// language breakdown, if it should not.
+func excludedFromLanguages(file, content string) string {
+	file = filepath.ToSlash(file)
+	if vendoredPath.MatchString(file) {
+		return "vendored"
+	}
+	if generatedPath.MatchString(file) {
+		return "generated"
+	}
+	head := content
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if generatedMarker.MatchString(head) {
+		return "generated"
+	}
+	return ""
+}
+
+func shebangLanguage(content string) (language, bool) {
+	if !strings.HasPrefix(content, "#!") {
+		return language{}, false
+	}
+	line, _, _ := strings.Cut(content, "\n")
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return language{}, false
+	}
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		// Skip env's own flags, as in "#!/usr/bin/env -S deno run".
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") {
+				interpreter = path.Base(field)
+				break
+			}
+		}
+	}
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+	if name, ok := interpreterLanguages[interpreter]; ok {
+		return language{name, langProgramming}, true
+	}
+	return language{}, false
+}
+
+// classifyFile picks a language for a file from, in order, its exact file
+// name, its extension and its shebang line.
+func classifyFile(file, content string) (language, bool) {
+	name := path.Base(filepath.ToSlash(file))
+	if lang, ok := filenameLanguages[name]; ok {
+		return lang, true
+	}
+	if strings.HasPrefix(name, "Dockerfile.") || strings.HasSuffix(name, ".dockerfile") {
+		return filenameLanguages["Dockerfile"], true
+	}
+	if lang, ok := extensionLanguages[strings.ToLower(path.Ext(name))]; ok {
+		return lang, true
+	}
+	return shebangLanguage(content)
+}
+
+// detectLanguages builds a linguist-style breakdown weighted by file size,
+// leaving out vendored and generated files. primary is the programming
+// language with the most bytes, or the largest language of any type if the
+// repository contains no code.
+func detectLanguages(sizes map[string]int64, code map[string]string) (stats []LanguageStat, primary string) {
+	byName := make(map[string]*LanguageStat)
+	var total int64
+	for file, size := range sizes {
+		content := code[file]
+		if excludedFromLanguages(file, content) != "" {
+			continue
+		}
+		lang, ok := classifyFile(file, content)
+		if !ok {
+			continue
+		}
+		stat, ok := byName[lang.name]
+		if !ok {
+			stat = &LanguageStat{Name: lang.name, Type: lang.kind}
+			byName[lang.name] = stat
+		}
+		stat.Files++
+		stat.Bytes += size
+		total += size
+	}
+
+	for _, stat := range byName {
+		if total > 0 {
+			stat.Percent = float64(stat.Bytes) * 100 / float64(total)
+		}
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Bytes != stats[j].Bytes {
+			return stats[i].Bytes > stats[j].Bytes
+		}
+		return stats[i].Name < stats[j].Name
+	})
+
+	for _, stat := range stats {
+		if stat.Type == langProgramming {
+			return stats, stat.Name
+		}
+	}
+	if len(stats) > 0 {
+		primary = stats[0].Name
+	}
+	return stats, primary
+}
+
+func formatLanguages(stats []LanguageStat) string {
+	var parts []string
+	for _, stat := range stats {
+		parts = append(parts, fmt.Sprintf("%s %.1f%% (%s, %d files)", stat.Name, stat.Percent, stat.Type, stat.Files))
+	}
+	return strings.Join(parts, "\n")
+}
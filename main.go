@@ -1,19 +1,16 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/joho/godotenv"
-	gitignore "github.com/sabhiram/go-gitignore"
-	"github.com/sashabaranov/go-openai"
+	"sync"
 )
 
 type ProjectContext struct {
@@ -22,218 +19,475 @@ type ProjectContext struct {
 }
 
 type Context struct {
-	ProjectName        string   `json:"project_name"`
-	ProjectDescription string   `json:"project_description"`
-	FileStructure      []string `json:"file_structure"`
+	ProjectName        string              `json:"project_name"`
+	ProjectDescription string              `json:"project_description"`
+	Languages          []LanguageStat      `json:"languages"`
+	EntryPoints        []EntryPoint        `json:"entry_points"`
+	Dependencies       []Dependency        `json:"dependencies,omitempty"`
+	GoPackages         []GoPackage         `json:"go_packages,omitempty"`
+	Symbols            map[string][]Symbol `json:"symbols,omitempty"`
+	FileStructure      []string            `json:"file_structure"`
+	FileNotes          map[string]string   `json:"file_notes,omitempty"`
 }
 
-func loadEnv() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file")
-	}
+type repoDetails struct {
+	PrimaryLang   string
+	Languages     []LanguageStat
+	FileStructure []string
+	CurrentCode   map[string]string
+	// FileNotes explains why a file in FileStructure is missing from
+	// CurrentCode or only partly included.
+	FileNotes map[string]string
 }
 
-func readGitignore(path string) (*gitignore.GitIgnore, error) {
-	file, err := os.Open(filepath.Join(path, ".gitignore"))
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
-	}
-	defer file.Close()
+// fileReaders is how many files getRepoDetails reads at once, so that the
+// walk does not wait on every read.
+const fileReaders = 8
 
-	var patterns []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		patterns = append(patterns, scanner.Text())
-	}
+func getRepoDetails(ctx context.Context, path string, ignore *repoIgnore, limits fileLimits) (*repoDetails, error) {
+	var fileStructure []string
+	currentCode := make(map[string]string)
+	fileNotes := make(map[string]string)
+	sizes := make(map[string]int64)
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	type readJob struct {
+		relPath string
+		size    int64
 	}
-
-	return gitignore.CompileIgnoreLines(patterns...), nil
-}
-
-func getRepoDetails(path string) (string, []string, string, map[string]string, error) {
-	gitignore, err := readGitignore(path)
-	if err != nil {
-		return "", nil, "", nil, err
+	var (
+		jobs    = make(chan readJob)
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		readErr error
+	)
+	for range fileReaders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				content, note, err := readFileContent(filepath.Join(path, job.relPath), job.size, limits)
+				mu.Lock()
+				if err != nil {
+					if readErr == nil {
+						readErr = err
+					}
+				} else {
+					if note != "" {
+						fileNotes[job.relPath] = note
+					}
+					if !strings.HasPrefix(note, "omitted") {
+						currentCode[job.relPath] = content
+					}
+				}
+				mu.Unlock()
+			}
+		}()
 	}
 
-	var fileStructure []string
-	currentCode := make(map[string]string)
-	err = filepath.Walk(path, func(filePath string, info fs.FileInfo, err error) error {
+	err := filepath.Walk(path, func(filePath string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-
-		relPath, err := filepath.Rel(path, filePath)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mu.Lock()
+		err = readErr
+		mu.Unlock()
 		if err != nil {
 			return err
 		}
 
-		if gitignore != nil && gitignore.MatchesPath(relPath) {
-			if info.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
+		relPath, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
 		}
 
 		if info.IsDir() && info.Name() == ".git" {
 			return filepath.SkipDir
 		}
 
-		if !info.IsDir() {
-			fileStructure = append(fileStructure, relPath)
-			content, err := os.ReadFile(filePath)
+		if relPath != "." {
+			ignored, err := ignore.ignored(relPath, info.IsDir())
 			if err != nil {
 				return err
 			}
-			currentCode[relPath] = string(content)
+			if ignored {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 		}
-		return nil
-	})
-	if err != nil {
-		return "", nil, "", nil, err
-	}
 
-	langs := make(map[string]int)
-	filepath.Walk(path, func(filePath string, info fs.FileInfo, err error) error {
-		if !info.IsDir() {
-			ext := filepath.Ext(info.Name())
-			langs[ext]++
+		if info.Mode().IsRegular() {
+			fileStructure = append(fileStructure, relPath)
+			sizes[relPath] = info.Size()
+			jobs <- readJob{relPath: relPath, size: info.Size()}
 		}
 		return nil
 	})
-
-	var primaryLang string
-	maxCount := 0
-	for lang, count := range langs {
-		if count > maxCount {
-			primaryLang = lang
-			maxCount = count
-		}
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	entryPoint := "main." + strings.TrimPrefix(primaryLang, ".")
+	languages, primaryLang := detectLanguages(sizes, currentCode)
 
-	return primaryLang, fileStructure, entryPoint, currentCode, nil
+	return &repoDetails{
+		PrimaryLang:   primaryLang,
+		Languages:     languages,
+		FileStructure: fileStructure,
+		CurrentCode:   currentCode,
+		FileNotes:     fileNotes,
+	}, nil
 }
 
-func generatePrompt(primaryLang string, fileStructure []string, entryPoint string) string {
-	fileStructureStr := strings.Join(fileStructure, "\n")
-	return fmt.Sprintf(
-		"Primary Language: %s\n\n"+
-			"File Structure:\n%s\n\n"+
-			"Entry Point: %s\n\n"+
-			"Based on the above information, please:\n"+
-			"1. Describe the purpose of the project.\n"+
-			"2. Provide a best guess description of the components and how they work with one another.\n",
-		primaryLang, fileStructureStr, entryPoint,
-	)
-}
+const minTokenBudget = 1000
 
-func callOpenAI(prompt string) (string, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	client := openai.NewClient(apiKey)
-	resp, err := client.CreateChatCompletion(context.TODO(), openai.ChatCompletionRequest{
-		Model: openai.GPT4o20240513,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    "system",
-				Content: "You are a helpful assistant.",
-			},
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-	})
+// complete renders the prompts for stage and returns the model's reply.
+func complete(ctx context.Context, completer Completer, prompts *promptSet, stage string, data promptData) (string, error) {
+	req, err := prompts.request(stage, data)
+	if err != nil {
+		return "", err
+	}
+	resp, err := completer.Complete(ctx, req)
 	if err != nil {
 		return "", err
 	}
-	return resp.Choices[0].Message.Content, nil
+	return resp.Content, nil
 }
 
 func safeFileName(path string) string {
 	return strings.ReplaceAll(strings.ReplaceAll(path, "/", "_"), "\\", "_")
 }
 
-func main() {
-	loadEnv()
+// pipeline holds the settings shared by every kind of run.
+type pipeline struct {
+	completer   Completer
+	prompts     *promptSet
+	outputDir   string
+	tokenBudget int
+	tree        bool
+	redactRules []redactRule
+	limits      fileLimits
+	include     []string
+	exclude     []string
+	goSource    bool
+	// concurrency bounds the model calls made at once.
+	concurrency int
+	outputs     []outputProfile
+	// descriptionDir holds the description from the last describe run. It
+	// is outputDir, except in a dry run.
+	descriptionDir string
+}
 
-	if len(os.Args) < 2 {
-		log.Fatal("Please provide a directory path")
+// loadIgnore reads the repository's ignore files and adds the -include and
+// -exclude patterns.
+func (p *pipeline) loadIgnore(ctx context.Context, dirPath string) (*repoIgnore, error) {
+	ignore, err := loadIgnore(ctx, dirPath)
+	if err != nil {
+		return nil, err
 	}
-	dirPath := os.Args[1]
+	ignore.addPatterns(p.include, p.exclude)
+	return ignore, nil
+}
+
+// repoAnalysis is everything learned about a repository without calling the
+// model.
+type repoAnalysis struct {
+	projectName string
+	details     *repoDetails
+	// code holds every file that was read, after redaction; currentCode is
+	// the part of it that is sent to the model.
+	code             map[string]string
+	currentCode      map[string]string
+	entryPoints      []EntryPoint
+	dependencies     []Dependency
+	goPackages       []GoPackage
+	packageSummaries map[string]string
+	symbols          map[string][]Symbol
+	graph            *DependencyGraph
+}
 
+// analyzeRepo walks the repository and runs every offline analysis, writing
+// the redaction report and dependency graph along the way.
+func (p *pipeline) analyzeRepo(ctx context.Context, dirPath string) (*repoAnalysis, error) {
+	outputDir := p.outputDir
 	projectName := filepath.Base(dirPath)
-	outputDir := filepath.Join("data", safeFileName(dirPath))
-	err := os.MkdirAll(outputDir, 0755)
+
+	ignore, err := p.loadIgnore(ctx, dirPath)
 	if err != nil {
-		log.Fatalf("Failed to create directories: %v", err)
+		return nil, fmt.Errorf("failed to read ignore files: %w", err)
 	}
-
-	primaryLang, fileStructure, entryPoint, currentCode, err := getRepoDetails(dirPath)
+	details, err := getRepoDetails(ctx, dirPath, ignore, p.limits)
 	if err != nil {
-		log.Fatalf("Failed to get repo details: %v", err)
+		return nil, fmt.Errorf("failed to get repo details: %w", err)
 	}
 
-	initialPrompt := generatePrompt(primaryLang, fileStructure, entryPoint)
-	fmt.Println("Initial Prompt:")
-	fmt.Println(initialPrompt)
+	// Secrets must be gone before anything is written to disk or sent to
+	// the model.
+	redactions := redactFiles(details.CurrentCode, p.redactRules)
+	if err := writeRedactionReport(outputDir, redactions); err != nil {
+		return nil, fmt.Errorf("failed to write redaction report: %w", err)
+	}
+	currentCode := maps.Clone(details.CurrentCode)
+
+	entryPoints := discoverEntryPoints(currentCode)
+	dependencies := parseDependencies(currentCode)
+
+	// Go packages are described by their structure rather than their raw
+	// source, unless asked otherwise.
+	goPackages := analyzeGoPackages(projectName, currentCode)
+	packageSummaries := make(map[string]string)
+	for _, pkg := range goPackages {
+		packageSummaries[pkg.Dir] = formatGoPackage(pkg)
+		if !p.goSource {
+			for _, file := range pkg.Files {
+				delete(currentCode, filepath.FromSlash(file))
+			}
+		}
+	}
 
-	finalPrompt, err := callOpenAI(initialPrompt)
+	symbols, err := extractSymbols(currentCode)
 	if err != nil {
-		log.Fatalf("Failed to call OpenAI: %v", err)
+		return nil, fmt.Errorf("failed to extract symbols: %w", err)
 	}
 
-	projectContext := ProjectContext{
+	graph := buildDependencyGraph(details.FileStructure, goPackages, symbols)
+	if err := writeDependencyGraph(outputDir, graph); err != nil {
+		return nil, fmt.Errorf("failed to write dependency graph: %w", err)
+	}
+
+	return &repoAnalysis{
+		projectName:      projectName,
+		details:          details,
+		code:             details.CurrentCode,
+		currentCode:      currentCode,
+		entryPoints:      entryPoints,
+		dependencies:     dependencies,
+		goPackages:       goPackages,
+		packageSummaries: packageSummaries,
+		symbols:          symbols,
+		graph:            graph,
+	}, nil
+}
+
+func (a *repoAnalysis) projectContext(description string) ProjectContext {
+	return ProjectContext{
 		Context: Context{
-			ProjectName:        projectName,
-			ProjectDescription: finalPrompt,
-			FileStructure:      fileStructure,
+			ProjectName:        a.projectName,
+			ProjectDescription: description,
+			Languages:          a.details.Languages,
+			EntryPoints:        a.entryPoints,
+			Dependencies:       a.dependencies,
+			GoPackages:         a.goPackages,
+			Symbols:            a.symbols,
+			FileStructure:      a.details.FileStructure,
+			FileNotes:          a.details.FileNotes,
 		},
-		CurrentCode: currentCode,
+		CurrentCode: a.currentCode,
 	}
+}
 
+// modelContext is the project context as it is sent to the model. The entry
+// points, dependencies, symbols, Go packages and file list can be far larger
+// than any prompt, so they are cut down to a share of the token budget each;
+// the full lists are in project_context.json.
+type modelContext struct {
+	Context
+	EntryPoints   string   `json:"entry_points"`
+	Dependencies  string   `json:"dependencies,omitempty"`
+	Symbols       string   `json:"symbols,omitempty"`
+	GoPackages    string   `json:"go_packages,omitempty"`
+	FileStructure []string `json:"file_structure"`
+}
+
+func (p *pipeline) modelContext(c Context) ([]byte, error) {
+	share := p.tokenBudget / 8
+	mc := modelContext{
+		Context:       c,
+		EntryPoints:   formatEntryPoints(c.EntryPoints, share/2),
+		Symbols:       formatSymbols(c.Symbols, share),
+		GoPackages:    formatGoPackages(c.GoPackages, share),
+		FileStructure: capLines(c.FileStructure, share, "files"),
+	}
+	if len(c.Dependencies) > 0 {
+		mc.Dependencies = formatDependencies(c.Dependencies, share)
+	}
+	return json.MarshalIndent(mc, "", "  ")
+}
+
+func writeProjectContext(outputDir string, projectContext ProjectContext) (string, error) {
 	jsonData, err := json.MarshalIndent(projectContext, "", "  ")
 	if err != nil {
-		log.Fatalf("Failed to marshal JSON: %v", err)
+		return "", fmt.Errorf("failed to marshal JSON: %w", err)
 	}
 
 	jsonFilePath := filepath.Join(outputDir, "project_context.json")
-	err = os.WriteFile(jsonFilePath, jsonData, 0644)
+	err = writeFile(jsonFilePath, jsonData)
+	if err != nil {
+		return "", fmt.Errorf("failed to write JSON file: %w", err)
+	}
+
+	progressf("Project context written to %s\n", jsonFilePath)
+	return jsonFilePath, nil
+}
+
+// buildContext writes project_context.json and the offline analyses without
+// calling the model.
+func (p *pipeline) buildContext(ctx context.Context, dirPath string) error {
+	analysis, err := p.analyzeRepo(ctx, dirPath)
 	if err != nil {
-		log.Fatalf("Failed to write JSON file: %v", err)
+		return err
 	}
+	_, err = writeProjectContext(p.outputDir, analysis.projectContext(""))
+	return err
+}
+
+// describeRepo writes the documents in p.outputs. When ctx is cancelled it
+// stops at the next model call, keeping what was written so far, including
+// the directory summaries finished with -tree.
+func (p *pipeline) describeRepo(ctx context.Context, dirPath string) error {
+	completer, outputDir, tokenBudget := p.completer, p.outputDir, p.tokenBudget
 
-	fmt.Printf("Project context written to %s\n", jsonFilePath)
+	analysis, err := p.analyzeRepo(ctx, dirPath)
+	if err != nil {
+		return err
+	}
+	projectName, details, currentCode, graph := analysis.projectName, analysis.details, analysis.currentCode, analysis.graph
+	fileStructure := details.FileStructure
+
+	initialData := promptData{
+		ProjectName:     projectName,
+		PrimaryLanguage: details.PrimaryLang,
+		Languages:       formatLanguages(details.Languages),
+		FileTree:        strings.Join(capLines(annotateFiles(fileStructure, details.FileNotes), tokenBudget/8, "files"), "\n"),
+		EntryPoints:     formatEntryPoints(analysis.entryPoints, tokenBudget/16),
+		Dependencies:    formatDependencies(analysis.dependencies, tokenBudget/8),
+		Symbols:         formatSymbols(analysis.symbols, tokenBudget/4),
+	}
+	initialPrompt, err := p.prompts.request(stageInitial, initialData)
+	if err != nil {
+		return err
+	}
+	// The lists are capped, but a custom template can still take the prompt
+	// over the budget.
+	if tokens := estimateTokens(initialPrompt.System) + estimateTokens(initialPrompt.Prompt); tokens > tokenBudget {
+		return fmt.Errorf("initial prompt is about %d tokens, over the %d token budget", tokens, tokenBudget)
+	}
+	debugf("Initial Prompt:\n%s\n", initialPrompt.Prompt)
+
+	finalPrompt, err := complete(ctx, completer, p.prompts, stageInitial, initialData)
+	if err != nil {
+		return fmt.Errorf("failed to call LLM: %w", err)
+	}
+
+	projectContext := analysis.projectContext(finalPrompt)
+	jsonFilePath, err := writeProjectContext(outputDir, projectContext)
+	if err != nil {
+		return err
+	}
 
 	// Read the JSON file contents to create a new prompt
 	jsonContent, err := os.ReadFile(jsonFilePath)
 	if err != nil {
-		log.Fatalf("Failed to read JSON file: %v", err)
+		return fmt.Errorf("failed to read JSON file: %w", err)
 	}
 
-	newPrompt := fmt.Sprintf(
-		"Take in the following json data, and attempt to write a detailed project description based off of the components and their interactions with one another:\n\n%s",
-		string(jsonContent),
-	)
+	descriptionData := promptData{ProjectName: projectName, Context: string(jsonContent)}
+	// Every output is written from the same data, so it has to fit the
+	// largest of their prompts.
+	outputTokens := func(data promptData) int {
+		largest := 0
+		for _, profile := range p.outputs {
+			largest = max(largest, p.prompts.tokens(profile.stage, data))
+		}
+		return largest
+	}
 
-	projectDescription, err := callOpenAI(newPrompt)
+	contextJSON, err := p.modelContext(projectContext.Context)
 	if err != nil {
-		log.Fatalf("Failed to call OpenAI for project description: %v", err)
+		return fmt.Errorf("failed to marshal JSON: %w", err)
 	}
 
-	mdFilePath := filepath.Join(outputDir, "project_description.md")
-	err = os.WriteFile(mdFilePath, []byte(projectDescription), 0644)
-	if err != nil {
-		log.Fatalf("Failed to write Markdown file: %v", err)
+	switch {
+	case p.tree:
+		root := buildDirTree(fileStructure)
+		err := p.summarizeTree(ctx, projectName, root, currentCode, analysis.packageSummaries)
+		if err != nil && !stopped(ctx, err) {
+			return fmt.Errorf("failed to summarize directories: %w", err)
+		}
+
+		summariesDir := filepath.Join(outputDir, "summaries")
+		if err := writeSummaryTree(root, summariesDir); err != nil {
+			return fmt.Errorf("failed to write directory summaries: %w", err)
+		}
+		if err != nil {
+			progressf("Partial directory summaries written to %s\n", summariesDir)
+			return fmt.Errorf("failed to summarize directories: %w", err)
+		}
+		progressf("Directory summaries written to %s\n", summariesDir)
+
+		descriptionData = promptData{ProjectName: projectName, Context: string(contextJSON), Summaries: root.Summary}
+	case outputTokens(descriptionData) > tokenBudget:
+		progressf("Project context is about %d tokens, over the %d token budget; summarizing code in chunks\n", outputTokens(descriptionData), tokenBudget)
+
+		descriptionData = promptData{ProjectName: projectName, Context: string(contextJSON)}
+		target := max(tokenBudget-outputTokens(descriptionData), tokenBudget/4)
+		summaries, err := p.summarizeCode(ctx, projectName, currentCode, target)
+		if err != nil {
+			return fmt.Errorf("failed to summarize code: %w", err)
+		}
+		descriptionData.Summaries = strings.Join(summaries, "\n\n")
 	}
 
-	fmt.Printf("Project description written to %s\n", mdFilePath)
+	// The documents do not depend on each other, so they are written
+	// concurrently, each as soon as it is done.
+	return forEach(ctx, p.concurrency, len(p.outputs), func(ctx context.Context, i int) error {
+		return p.writeOutput(ctx, p.outputs[i], descriptionData, graph)
+	})
+}
+
+// writeOutput asks the model for one document and writes it.
+func (p *pipeline) writeOutput(ctx context.Context, profile outputProfile, data promptData, graph *DependencyGraph) error {
+	var document string
+	if profile.structured {
+		description, err := completeStructured(ctx, p.completer, p.prompts, profile.stage, data)
+		if err != nil {
+			return fmt.Errorf("failed to get structured description: %w", err)
+		}
+		out, err := json.MarshalIndent(description, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		document = string(out) + "\n"
+	} else {
+		var err error
+		document, err = complete(ctx, p.completer, p.prompts, profile.stage, data)
+		if err != nil {
+			return fmt.Errorf("failed to call LLM for %s: %w", profile.name, err)
+		}
+	}
+	if profile.graph && len(graph.Edges) > 0 {
+		document += "\n\n## Dependency Graph\n\n```mermaid\n" + graph.mermaid() + "```\n"
+	}
+
+	filePath := filepath.Join(p.outputDir, profile.file)
+	if err := writeFile(filePath, []byte(document)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", profile.file, err)
+	}
+	progressf("%s written to %s\n", profile.title, filePath)
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		log.Print(err)
+		os.Exit(exitStatus(err))
+	}
 }
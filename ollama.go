@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultOllamaURL = "http://localhost:11434"
+
+type ollamaCompleter struct {
+	client      *http.Client
+	baseURL     string
+	model       string
+	temperature *float32
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+type ollamaOptions struct {
+	Temperature *float32 `json:"temperature,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Error           string        `json:"error"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+func newOllamaCompleter(cfg ProviderConfig) (Completer, error) {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOllamaURL
+	}
+	return &ollamaCompleter{
+		client:      &http.Client{},
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		model:       cfg.Model,
+		temperature: cfg.Temperature,
+	}, nil
+}
+
+func (c *ollamaCompleter) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	chatReq := ollamaChatRequest{
+		Model: c.model,
+		Messages: []ollamaMessage{
+			{Role: "system", Content: req.System},
+			{Role: "user", Content: req.Prompt},
+		},
+		Format: req.Schema,
+	}
+	if c.temperature != nil {
+		chatReq.Options = &ollamaOptions{Temperature: c.temperature}
+	}
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return Completion{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	var chat ollamaChatResponse
+	if err := json.Unmarshal(data, &chat); err != nil {
+		return Completion{}, c.statusError(resp, strings.TrimSpace(string(data)))
+	}
+	if resp.StatusCode != http.StatusOK || chat.Error != "" {
+		return Completion{}, c.statusError(resp, chat.Error)
+	}
+	return Completion{
+		Content: chat.Message.Content,
+		Usage:   Usage{PromptTokens: chat.PromptEvalCount, CompletionTokens: chat.EvalCount},
+	}, nil
+}
+
+func (c *ollamaCompleter) statusError(resp *http.Response, message string) error {
+	return &statusError{
+		statusCode: resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		err:        fmt.Errorf("ollama returned %s: %s", resp.Status, message),
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type openAICompleter struct {
+	client      *openai.Client
+	model       string
+	temperature *float32
+}
+
+// retryAfterKey carries a slot for the response's Retry-After header through
+// go-openai, whose errors do not include response headers.
+type retryAfterKey struct{}
+
+type retryAfterRecorder struct {
+	client *http.Client
+}
+
+func (r retryAfterRecorder) Do(req *http.Request) (*http.Response, error) {
+	resp, err := r.client.Do(req)
+	if err == nil {
+		if slot, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+			*slot = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+	}
+	return resp, err
+}
+
+func newOpenAIClient(cfg ProviderConfig, config openai.ClientConfig) *openAICompleter {
+	config.HTTPClient = retryAfterRecorder{client: &http.Client{}}
+	return &openAICompleter{client: openai.NewClientWithConfig(config), model: cfg.Model, temperature: cfg.Temperature}
+}
+
+func newOpenAICompleter(cfg ProviderConfig) (Completer, error) {
+	config := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		config.BaseURL = cfg.BaseURL
+	}
+	return newOpenAIClient(cfg, config), nil
+}
+
+func newCompatibleCompleter(cfg ProviderConfig) (Completer, error) {
+	if cfg.BaseURL == "" {
+		return nil, errors.New("openai-compatible provider requires a base URL")
+	}
+	return newOpenAICompleter(cfg)
+}
+
+func newAzureCompleter(cfg ProviderConfig) (Completer, error) {
+	if cfg.BaseURL == "" {
+		return nil, errors.New("azure provider requires a base URL")
+	}
+	return newOpenAIClient(cfg, openai.DefaultAzureConfig(cfg.APIKey, cfg.BaseURL)), nil
+}
+
+func newAnthropicCompleter(cfg ProviderConfig) (Completer, error) {
+	return newOpenAIClient(cfg, openai.DefaultAnthropicConfig(cfg.APIKey, cfg.BaseURL)), nil
+}
+
+func (c *openAICompleter) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	chatReq := openai.ChatCompletionRequest{
+		Model: c.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: req.System,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: req.Prompt,
+			},
+		},
+	}
+	if c.temperature != nil {
+		chatReq.Temperature = *c.temperature
+		// A zero temperature would be dropped by omitempty.
+		if chatReq.Temperature == 0 {
+			chatReq.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+	if req.Schema != nil {
+		chatReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   req.SchemaName,
+				Schema: req.Schema,
+				Strict: true,
+			},
+		}
+	}
+
+	var retryAfter time.Duration
+	ctx = context.WithValue(ctx, retryAfterKey{}, &retryAfter)
+	resp, err := c.client.CreateChatCompletion(ctx, chatReq)
+	if err != nil {
+		var apiErr *openai.APIError
+		var reqErr *openai.RequestError
+		switch {
+		case errors.As(err, &apiErr):
+			return Completion{}, &statusError{statusCode: apiErr.HTTPStatusCode, retryAfter: retryAfter, err: err}
+		case errors.As(err, &reqErr):
+			return Completion{}, &statusError{statusCode: reqErr.HTTPStatusCode, retryAfter: retryAfter, err: err}
+		}
+		return Completion{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return Completion{}, errors.New("model returned no choices")
+	}
+	return Completion{
+		Content: resp.Choices[0].Message.Content,
+		Usage:   Usage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens},
+	}, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// outputProfile is a kind of document describeRepo can write. Every profile
+// is built by its own prompt stage from the same project context and code
+// summaries.
+type outputProfile struct {
+	name  string
+	title string
+	stage string
+	file  string
+	// graph appends the package dependency graph as a Mermaid diagram.
+	graph bool
+	// structured asks for a StructuredDescription instead of Markdown.
+	structured bool
+}
+
+const defaultOutputType = "description"
+
+var outputProfiles = []outputProfile{
+	{name: "description", title: "Project description", stage: stageDescription, file: "project_description.md", graph: true},
+	{name: "readme", title: "README", stage: "readme", file: "README.md"},
+	{name: "architecture", title: "Architecture overview", stage: "architecture", file: "ARCHITECTURE.md", graph: true},
+	{name: "onboarding", title: "Onboarding guide", stage: "onboarding", file: "CONTRIBUTING.md"},
+	{name: "api", title: "API overview", stage: "api", file: "API.md"},
+	{name: "faq", title: "FAQ", stage: "faq", file: "FAQ.md"},
+	{name: "json", title: "Structured description", stage: "structured", file: "project_description.json", structured: true},
+}
+
+func outputTypeNames() []string {
+	var names []string
+	for _, profile := range outputProfiles {
+		names = append(names, profile.name)
+	}
+	return names
+}
+
+// parseOutputTypes looks up a comma-separated list of profile names.
+func parseOutputTypes(list string) ([]outputProfile, error) {
+	var profiles []outputProfile
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		found := false
+		for _, profile := range outputProfiles {
+			if profile.name == name {
+				profiles = append(profiles, profile)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown output type %q; choose from %s", name, strings.Join(outputTypeNames(), ", "))
+		}
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no output type given; choose from %s", strings.Join(outputTypeNames(), ", "))
+	}
+	return profiles, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultConcurrency is how many model calls run at once by default.
+const defaultConcurrency = 4
+
+// forEach calls fn for every index below n, at most limit at a time. Callers
+// store results by index, so they come out in order however the calls
+// interleave. After the first error no more calls are started and the ones
+// in progress are cancelled; that error is returned once they have finished.
+func forEach(ctx context.Context, limit, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	slots := make(chan struct{}, max(limit, 1))
+	for i := 0; i < n; i++ {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
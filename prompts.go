@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Prompt stages. Each has a user template, <stage>.user.tmpl, and may have
+// its own system template, <stage>.system.tmpl; otherwise system.tmpl is
+// used.
+const (
+	stageInitial     = "initial"
+	stageDescription = "description"
+	stageChunk       = "chunk"
+	stageMerge       = "merge"
+	stageDirectory   = "directory"
+	stageDiffChunk   = "diff-chunk"
+	stageDiff        = "diff"
+	stageAsk         = "ask"
+)
+
+var promptStages = []string{stageInitial, stageDescription, stageChunk, stageMerge, stageDirectory, stageDiffChunk, stageDiff, stageAsk, "readme", "architecture", "onboarding", "api", "faq", "structured"}
+
+const (
+	defaultPromptSet = "default"
+	promptSetsDir    = ".describe-prompts"
+)
+
+//go:embed prompts
+var embeddedPrompts embed.FS
+
+// promptData is what prompt templates can refer to. Fields a stage has no
+// use for are empty.
+type promptData struct {
+	ProjectName         string // every stage
+	Question            string // ask
+	PrimaryLanguage     string // initial
+	Languages           string // initial: breakdown by size, one per line
+	FileTree            string // initial: file paths, one per line, with notes on omitted or truncated files
+	EntryPoints         string // initial
+	Dependencies        string // initial
+	Symbols             string // initial: symbols by file, one file per line
+	Context             string // description, ask: project context as JSON
+	Code                string // chunk, directory, diff-chunk, diff, ask: rendered files or diffs
+	Summaries           string // description, merge: summaries from earlier calls
+	Directory           string // directory
+	PreviousDescription string // diff, ask: project_description.md from the last describe run
+	Commits             string // diff: git log --oneline for the range
+	Response            string // structured: the previous reply, when it did not validate
+	ValidationError     string // structured: why the previous reply did not validate
+}
+
+type promptSet struct {
+	name      string
+	templates map[string]*template.Template
+}
+
+// loadPromptSet finds the prompt set called name: a directory of that name
+// under .describe-prompts in the repository, a directory at that path, or a
+// set built into the binary. Templates missing from a set on disk fall back
+// to the built-in default set, so a set only needs the files it changes.
+func loadPromptSet(repoPath, name string) (*promptSet, error) {
+	if name == "" {
+		name = defaultPromptSet
+	}
+
+	defaults, err := fs.Sub(embeddedPrompts, "prompts/"+defaultPromptSet)
+	if err != nil {
+		return nil, err
+	}
+	sources := []fs.FS{defaults}
+
+	if name != defaultPromptSet {
+		dir, err := findPromptSet(repoPath, name)
+		if err != nil {
+			return nil, err
+		}
+		sources = append([]fs.FS{dir}, sources...)
+	}
+
+	set := &promptSet{name: name, templates: make(map[string]*template.Template)}
+	for _, stage := range promptStages {
+		for _, file := range []string{stage + ".system.tmpl", stage + ".user.tmpl"} {
+			tmpl, err := parsePromptTemplate(sources, file)
+			if err != nil {
+				return nil, err
+			}
+			if tmpl != nil {
+				set.templates[file] = tmpl
+			}
+		}
+		if set.templates[stage+".user.tmpl"] == nil {
+			return nil, fmt.Errorf("prompt set %s has no %s.user.tmpl", name, stage)
+		}
+	}
+	system, err := parsePromptTemplate(sources, "system.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if system != nil {
+		set.templates["system.tmpl"] = system
+	}
+	return set, nil
+}
+
+func findPromptSet(repoPath, name string) (fs.FS, error) {
+	for _, dir := range []string{filepath.Join(repoPath, promptSetsDir, name), name} {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return os.DirFS(dir), nil
+		}
+	}
+	if sub, err := fs.Sub(embeddedPrompts, "prompts/"+name); err == nil {
+		if _, err := fs.Stat(sub, "."); err == nil {
+			return sub, nil
+		}
+	}
+	return nil, fmt.Errorf("prompt set %q not found in %s or as a directory", name, filepath.Join(repoPath, promptSetsDir))
+}
+
+// parsePromptTemplate parses file from the first source that has it, and
+// checks that it only refers to fields promptData has. It returns nil if no
+// source has the file.
+func parsePromptTemplate(sources []fs.FS, file string) (*template.Template, error) {
+	for _, source := range sources {
+		data, err := fs.ReadFile(source, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Files end with a newline that is not part of the prompt.
+		text := strings.TrimSuffix(string(data), "\n")
+		tmpl, err := template.New(file).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt template: %w", err)
+		}
+		if err := checkPromptFields(tmpl); err != nil {
+			return nil, fmt.Errorf("prompt template %s: %w", file, err)
+		}
+		return tmpl, nil
+	}
+	return nil, nil
+}
+
+// checkPromptFields catches misspelled variables when a set is loaded
+// rather than in whichever branch of a template happens to use them.
+func checkPromptFields(tmpl *template.Template) error {
+	fields := reflect.TypeOf(promptData{})
+	var check func(node parse.Node) error
+	check = func(node parse.Node) error {
+		if node == nil || reflect.ValueOf(node).IsNil() {
+			return nil
+		}
+		switch n := node.(type) {
+		case *parse.FieldNode:
+			if _, ok := fields.FieldByName(n.Ident[0]); !ok {
+				return fmt.Errorf("unknown variable .%s", n.Ident[0])
+			}
+		case *parse.ListNode:
+			for _, child := range n.Nodes {
+				if err := check(child); err != nil {
+					return err
+				}
+			}
+		case *parse.ActionNode:
+			return check(n.Pipe)
+		case *parse.PipeNode:
+			for _, cmd := range n.Cmds {
+				if err := check(cmd); err != nil {
+					return err
+				}
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				if err := check(arg); err != nil {
+					return err
+				}
+			}
+		case *parse.IfNode:
+			return checkBranch(check, &n.BranchNode)
+		case *parse.RangeNode:
+			return checkBranch(check, &n.BranchNode)
+		case *parse.WithNode:
+			return checkBranch(check, &n.BranchNode)
+		}
+		return nil
+	}
+	for _, t := range tmpl.Templates() {
+		if err := check(t.Root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkBranch(check func(parse.Node) error, b *parse.BranchNode) error {
+	for _, node := range []parse.Node{b.Pipe, b.List, b.ElseList} {
+		if err := check(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// request renders the system and user templates for stage.
+func (ps *promptSet) request(stage string, data promptData) (CompletionRequest, error) {
+	system := ps.templates[stage+".system.tmpl"]
+	if system == nil {
+		system = ps.templates["system.tmpl"]
+	}
+	req := CompletionRequest{Stage: stage}
+	if system != nil {
+		var b bytes.Buffer
+		if err := system.Execute(&b, data); err != nil {
+			return req, fmt.Errorf("failed to render %s system prompt: %w", stage, err)
+		}
+		req.System = b.String()
+	}
+
+	var b bytes.Buffer
+	if err := ps.templates[stage+".user.tmpl"].Execute(&b, data); err != nil {
+		return req, fmt.Errorf("failed to render %s prompt: %w", stage, err)
+	}
+	req.Prompt = b.String()
+	return req, nil
+}
+
+// tokens estimates the size of the rendered prompts for stage. A template
+// that fails to render counts as empty here; the error surfaces when the
+// prompt is sent.
+func (ps *promptSet) tokens(stage string, data promptData) int {
+	req, _ := ps.request(stage, data)
+	return estimateTokens(req.System) + estimateTokens(req.Prompt)
+}
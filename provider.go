@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type CompletionRequest struct {
+	// Stage is the pipeline stage the request is for, for the usage report.
+	// It is not sent.
+	Stage  string
+	System string
+	Prompt string
+	// Schema, when set, is a JSON Schema the reply must conform to. Backends
+	// that support structured output are asked to enforce it.
+	Schema     json.RawMessage
+	SchemaName string
+	// Validate, when set, checks a reply. Replies that fail are returned
+	// but never cached, so a rejected reply is not replayed by later runs.
+	Validate func(content string) error
+}
+
+type Completion struct {
+	Content string
+	// Usage is zero when the backend does not report it.
+	Usage Usage
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Completer is implemented by every LLM backend the pipeline can talk to.
+type Completer interface {
+	Complete(ctx context.Context, req CompletionRequest) (Completion, error)
+}
+
+type ProviderConfig struct {
+	Name    string
+	Model   string
+	BaseURL string
+	APIKey  string
+	// APIKeyFile and APIKeyCommand are other places to get the API key
+	// from; see apiKey.
+	APIKeyFile    string
+	APIKeyCommand string
+	// Temperature is left to the provider when nil.
+	Temperature *float32
+}
+
+type provider struct {
+	description  string
+	defaultModel string
+	keyEnv       string
+	// requiresKey providers cannot work without an API key; for the others
+	// it is optional.
+	requiresKey bool
+	// local providers run on this machine and cost nothing.
+	local bool
+	new   func(cfg ProviderConfig) (Completer, error)
+}
+
+const defaultProvider = "openai"
+
+var providers = map[string]provider{
+	"openai": {
+		description:  "OpenAI chat completions API",
+		defaultModel: "gpt-4o-2024-05-13",
+		keyEnv:       "OPENAI_API_KEY",
+		requiresKey:  true,
+		new:          newOpenAICompleter,
+	},
+	"openai-compatible": {
+		description:  "any OpenAI-compatible endpoint at -base-url (gateways, llama.cpp server, vLLM)",
+		defaultModel: "gpt-4o-2024-05-13",
+		keyEnv:       "OPENAI_API_KEY",
+		new:          newCompatibleCompleter,
+	},
+	"azure": {
+		description:  "Azure OpenAI deployment at -base-url",
+		defaultModel: "gpt-4o-2024-05-13",
+		keyEnv:       "AZURE_OPENAI_API_KEY",
+		requiresKey:  true,
+		new:          newAzureCompleter,
+	},
+	"anthropic": {
+		description:  "Anthropic API through its OpenAI-compatible endpoint",
+		defaultModel: "claude-3-5-sonnet-latest",
+		keyEnv:       "ANTHROPIC_API_KEY",
+		requiresKey:  true,
+		new:          newAnthropicCompleter,
+	},
+	"ollama": {
+		description:  "local Ollama server",
+		defaultModel: "llama3",
+		local:        true,
+		new:          newOllamaCompleter,
+	},
+	"fake": {
+		description:  "offline canned responses, for testing the pipeline",
+		defaultModel: "fake",
+		local:        true,
+		new:          newFakeCompleter,
+	},
+}
+
+func providerNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withDefaults fills in the provider's default model, leaving an
+// explicitly configured one alone.
+func (cfg ProviderConfig) withDefaults() ProviderConfig {
+	p, ok := providers[cfg.Name]
+	if !ok {
+		return cfg
+	}
+	if cfg.Model == "" {
+		cfg.Model = p.defaultModel
+	}
+	return cfg
+}
+
+// cacheModel identifies the model settings a cached response depends on.
+func (cfg ProviderConfig) cacheModel() string {
+	model := cfg.Name + "/" + cfg.Model
+	if cfg.Temperature != nil {
+		model += fmt.Sprintf("@%g", *cfg.Temperature)
+	}
+	return model
+}
+
+func newCompleter(cfg ProviderConfig) (Completer, error) {
+	p, ok := providers[cfg.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q (available: %s)", cfg.Name, strings.Join(providerNames(), ", "))
+	}
+	cfg = cfg.withDefaults()
+
+	key, err := cfg.apiKey(p.keyEnv)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" && p.requiresKey {
+		return nil, fmt.Errorf("the %s provider needs an API key: set %s in the environment or a .env file, or set api_key_file or api_key_command", cfg.Name, p.keyEnv)
+	}
+	cfg.APIKey = key
+	return p.new(cfg)
+}
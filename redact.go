@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// redactRulesFile is read from the root of the described repository, if
+// present, to add project-specific redaction rules.
+const redactRulesFile = ".describe-redact.json"
+
+type redactRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	// Group selects the capture group holding the secret; 0 redacts the
+	// whole match.
+	Group int `json:"group,omitempty"`
+	// MinEntropy, when set, only redacts matches whose Shannon entropy in
+	// bits per character is at least this high.
+	MinEntropy float64 `json:"min_entropy,omitempty"`
+	// Files and SkipFiles are globs matched against file base names that
+	// limit which files the rule applies to.
+	Files     []string `json:"files,omitempty"`
+	SkipFiles []string `json:"skip_files,omitempty"`
+
+	re *regexp.Regexp
+}
+
+type redactConfig struct {
+	Rules []redactRule `json:"rules"`
+	// Disable lists built-in rules to turn off, by name.
+	Disable []string `json:"disable"`
+}
+
+type Redaction struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+}
+
+var lockFiles = []string{"go.sum", "package-lock.json", "yarn.lock", "pnpm-lock.yaml", "Cargo.lock", "poetry.lock", "Gemfile.lock", "composer.lock"}
+
+var builtinRedactRules = []redactRule{
+	{Name: "private-key", Pattern: `-----BEGIN [A-Z ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY( BLOCK)?-----`},
+	{Name: "aws-access-key-id", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "github-token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`},
+	{Name: "openai-api-key", Pattern: `\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}`},
+	{Name: "slack-token", Pattern: `\bxox[abprs]-[A-Za-z0-9-]{10,}`},
+	{Name: "google-api-key", Pattern: `\bAIza[0-9A-Za-z_-]{35}\b`},
+	{Name: "stripe-key", Pattern: `\b[rs]k_(?:live|test)_[0-9A-Za-z]{16,}`},
+	{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`},
+	{Name: "dotenv-value", Pattern: `(?m)^[ \t]*(?:export[ \t]+)?[A-Za-z_][A-Za-z0-9_]*[ \t]*=[ \t]*(\S.*)$`, Group: 1, Files: []string{".env", ".env.*", "*.env"}, SkipFiles: []string{".env.example", ".env.sample", ".env.template"}},
+	{Name: "secret-assignment", Pattern: `(?i)\b[A-Z0-9_.-]*(?:secret|token|passw(?:or)?d|api[_-]?key|access[_-]?key|private[_-]?key|credentials?)[A-Z0-9_.-]*["']?[ \t]*[:=][ \t]*["']([^\s"']{8,})["']`, Group: 1, MinEntropy: 3.2},
+	{Name: "high-entropy", Pattern: `[A-Za-z0-9+/_-]{32,}={0,2}`, MinEntropy: 4.5, SkipFiles: lockFiles},
+}
+
+// loadRedactRules returns the built-in rules adjusted by the rule file at
+// rulesPath, or by .describe-redact.json in the repository when rulesPath is
+// empty.
+func loadRedactRules(repoPath, rulesPath string) ([]redactRule, error) {
+	var config redactConfig
+	file := rulesPath
+	if file == "" {
+		file = filepath.Join(repoPath, redactRulesFile)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil && (rulesPath != "" || !os.IsNotExist(err)) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	var rules []redactRule
+	for _, rule := range builtinRedactRules {
+		if !slices.Contains(config.Disable, rule.Name) {
+			rules = append(rules, rule)
+		}
+	}
+	rules = append(rules, config.Rules...)
+
+	for i := range rules {
+		re, err := regexp.Compile(rules[i].Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %q: %w", rules[i].Name, err)
+		}
+		if rules[i].Group > re.NumSubexp() {
+			return nil, fmt.Errorf("redaction rule %q: pattern has no group %d", rules[i].Name, rules[i].Group)
+		}
+		rules[i].re = re
+	}
+	return rules, nil
+}
+
+func matchesAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactRule) appliesTo(file string) bool {
+	name := path.Base(filepath.ToSlash(file))
+	if len(r.Files) > 0 && !matchesAny(r.Files, name) {
+		return false
+	}
+	return !matchesAny(r.SkipFiles, name)
+}
+
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len([]rune(s)))
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+type secretSpan struct {
+	start, end int
+	rule       string
+}
+
+// redact replaces every secret the rules find in content with a marker
+// naming the rule, and reports where each one was.
+func redact(file, content string, rules []redactRule) (string, []Redaction) {
+	var spans []secretSpan
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.appliesTo(file) {
+			continue
+		}
+		for _, m := range rule.re.FindAllStringSubmatchIndex(content, -1) {
+			start, end := m[2*rule.Group], m[2*rule.Group+1]
+			if start < 0 || start == end {
+				continue
+			}
+			if rule.MinEntropy > 0 && shannonEntropy(content[start:end]) < rule.MinEntropy {
+				continue
+			}
+			spans = append(spans, secretSpan{start, end, rule.Name})
+		}
+	}
+	if len(spans) == 0 {
+		return content, nil
+	}
+
+	// Earlier, then longer, spans win when rules overlap.
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+
+	var b strings.Builder
+	var redactions []Redaction
+	last := 0
+	for _, span := range spans {
+		if span.start < last {
+			continue
+		}
+		b.WriteString(content[last:span.start])
+		b.WriteString("[REDACTED:" + span.rule + "]")
+		redactions = append(redactions, Redaction{
+			File: file,
+			Line: 1 + strings.Count(content[:span.start], "\n"),
+			Rule: span.rule,
+		})
+		last = span.end
+	}
+	b.WriteString(content[last:])
+	return b.String(), redactions
+}
+
+// redactFiles redacts every file in code in place.
+func redactFiles(code map[string]string, rules []redactRule) []Redaction {
+	var report []Redaction
+	for _, file := range sortedKeys(code) {
+		redacted, redactions := redact(file, code[file], rules)
+		if len(redactions) > 0 {
+			code[file] = redacted
+			report = append(report, redactions...)
+		}
+	}
+	return report
+}
+
+func writeRedactionReport(outputDir string, report []Redaction) error {
+	if report == nil {
+		report = []Redaction{}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	reportPath := filepath.Join(outputDir, "redactions.json")
+	if err := writeFile(reportPath, data); err != nil {
+		return err
+	}
+
+	files := make(map[string]bool)
+	for _, r := range report {
+		files[r.File] = true
+	}
+	progressf("Redacted %d secrets in %d files; report written to %s\n", len(report), len(files), reportPath)
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+)
+
+// statusError is an HTTP error response from a backend. It lets the retry
+// layer tell transient failures from permanent ones and honor Retry-After.
+type statusError struct {
+	statusCode int
+	retryAfter time.Duration
+	err        error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+func (e *statusError) Unwrap() error { return e.err }
+
+// parseRetryAfter reads a Retry-After header, which is either a number of
+// seconds or an HTTP date. It returns 0 if there is none.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// retryPolicy configures retryingCompleter. Zero limits mean unlimited.
+type retryPolicy struct {
+	maxAttempts       int
+	timeout           time.Duration
+	requestsPerMinute int
+	tokensPerMinute   int
+	// concurrency bounds the attempts in flight at once.
+	concurrency int
+}
+
+// retryingCompleter retries transient failures with exponential backoff and
+// jitter, gives every attempt its own timeout, and keeps requests, prompt
+// tokens and calls in flight under the configured limits. It is safe for
+// concurrent use, and concurrent callers share its limits, however deeply
+// their own work is nested.
+type retryingCompleter struct {
+	next     Completer
+	policy   retryPolicy
+	requests *rate.Limiter
+	tokens   *rate.Limiter
+	slots    chan struct{}
+}
+
+func newRetryingCompleter(next Completer, policy retryPolicy) *retryingCompleter {
+	c := &retryingCompleter{next: next, policy: policy}
+	if policy.concurrency > 0 {
+		c.slots = make(chan struct{}, policy.concurrency)
+	}
+	if policy.requestsPerMinute > 0 {
+		c.requests = rate.NewLimiter(rate.Every(time.Minute/time.Duration(policy.requestsPerMinute)), 1)
+	}
+	if policy.tokensPerMinute > 0 {
+		c.tokens = rate.NewLimiter(rate.Limit(float64(policy.tokensPerMinute)/60), policy.tokensPerMinute)
+	}
+	return c
+}
+
+func (c *retryingCompleter) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	tokens := estimateTokens(req.System) + estimateTokens(req.Prompt)
+	for attempt := 1; ; attempt++ {
+		if err := c.wait(ctx, tokens); err != nil {
+			return Completion{}, err
+		}
+
+		resp, err := c.attempt(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		giveUp := ctx.Err() != nil || !retryable(err) || attempt >= c.policy.maxAttempts
+
+		delay := backoff(attempt)
+		var status *statusError
+		if !giveUp && errors.As(err, &status) && status.retryAfter > 0 {
+			// Waiting is capped like backoff, so a server asking for more
+			// than every remaining attempt could wait out is not retried.
+			remaining := time.Duration(c.policy.maxAttempts-attempt) * retryMaxDelay
+			if c.policy.maxAttempts > 0 && status.retryAfter > remaining {
+				err = fmt.Errorf("server asked to retry after %s: %w", status.retryAfter.Round(time.Second), err)
+				giveUp = true
+			}
+			delay = min(status.retryAfter, retryMaxDelay)
+		}
+		if deadline, ok := ctx.Deadline(); !giveUp && ok && time.Until(deadline) < delay {
+			err = fmt.Errorf("not retrying, the run would time out first: %w", err)
+			giveUp = true
+		}
+		if giveUp {
+			if attempt > 1 {
+				err = fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return Completion{}, err
+		}
+		progressf("Model call failed (%v); retrying in %s (attempt %d/%d)\n", err, delay.Round(time.Second), attempt+1, c.policy.maxAttempts)
+		select {
+		case <-ctx.Done():
+			return Completion{}, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *retryingCompleter) attempt(ctx context.Context, req CompletionRequest) (Completion, error) {
+	if c.slots != nil {
+		select {
+		case c.slots <- struct{}{}:
+			defer func() { <-c.slots }()
+		case <-ctx.Done():
+			return Completion{}, ctx.Err()
+		}
+	}
+	if c.policy.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.policy.timeout)
+		defer cancel()
+	}
+	return c.next.Complete(ctx, req)
+}
+
+func (c *retryingCompleter) wait(ctx context.Context, tokens int) error {
+	if c.requests != nil {
+		if err := c.requests.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if c.tokens != nil {
+		// A prompt larger than a whole minute's allowance still has to go
+		// through eventually.
+		if err := c.tokens.WaitN(ctx, min(tokens, c.tokens.Burst())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff is the delay before retrying after the given attempt: doubling
+// from retryBaseDelay up to retryMaxDelay, with the upper half randomized so
+// that concurrent callers do not retry in lockstep.
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 16 {
+		delay = min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryable reports whether err is worth another attempt: rate limiting,
+// server errors, timeouts of the attempt and network failures.
+func retryable(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		switch status.statusCode {
+		case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+			return true
+		}
+		return status.statusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
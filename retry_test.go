@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	status := func(code int) error {
+		return &statusError{statusCode: code, err: fmt.Errorf("status %d", code)}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", status(http.StatusTooManyRequests), true},
+		{"request timeout", status(http.StatusRequestTimeout), true},
+		{"conflict", status(http.StatusConflict), true},
+		{"server error", status(http.StatusInternalServerError), true},
+		{"unavailable", status(http.StatusServiceUnavailable), true},
+		{"bad request", status(http.StatusBadRequest), false},
+		{"unauthorized", status(http.StatusUnauthorized), false},
+		{"wrapped", fmt.Errorf("calling model: %w", status(http.StatusBadGateway)), true},
+		{"attempt timeout", context.DeadlineExceeded, true},
+		{"network", &net.DNSError{Err: "no such host", Name: "api.example.com"}, true},
+		{"other", errors.New("invalid reply"), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("%s: retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// failingCompleter fails every call with err.
+type failingCompleter struct {
+	err   error
+	calls int
+}
+
+func (c *failingCompleter) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	c.calls++
+	return Completion{}, c.err
+}
+
+func TestRetryGivesUpOnLongRetryAfter(t *testing.T) {
+	next := &failingCompleter{err: &statusError{statusCode: http.StatusTooManyRequests, retryAfter: 24 * time.Hour, err: errors.New("rate limited")}}
+	c := newRetryingCompleter(next, retryPolicy{maxAttempts: 5})
+
+	start := time.Now()
+	_, err := c.Complete(context.Background(), CompletionRequest{})
+	if err == nil || !strings.Contains(err.Error(), "retry after 24h") {
+		t.Errorf("err = %v, want it to give up on the Retry-After", err)
+	}
+	if next.calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("made %d calls in %s, want 1 at once", next.calls, time.Since(start))
+	}
+}
+
+func TestRetryStopsAtNonRetryable(t *testing.T) {
+	next := &failingCompleter{err: &statusError{statusCode: http.StatusUnauthorized, err: errors.New("bad key")}}
+	c := newRetryingCompleter(next, retryPolicy{maxAttempts: 5})
+	if _, err := c.Complete(context.Background(), CompletionRequest{}); err == nil || next.calls != 1 {
+		t.Errorf("err = %v after %d calls, want an error after 1", err, next.calls)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// maxStructuredAttempts bounds how often a reply that does not match the
+// schema is sent back to the model to be fixed.
+const maxStructuredAttempts = 3
+
+// StructuredDescription is the machine-readable project description written
+// by the json output type. Its JSON Schema is generated from these types.
+type StructuredDescription struct {
+	Name        string                `json:"name" description:"Project name"`
+	Purpose     string                `json:"purpose" description:"What the project does and who it is for, in one paragraph"`
+	Components  []DescribedComponent  `json:"components" description:"The major parts of the project"`
+	EntryPoints []DescribedEntryPoint `json:"entry_points" description:"How the project is run or used"`
+	TechStack   []TechStackItem       `json:"tech_stack" description:"Languages, frameworks, libraries and services the project relies on"`
+}
+
+type DescribedComponent struct {
+	Name             string              `json:"name" description:"Short, unique name of the component"`
+	Paths            []string            `json:"paths" description:"Files or directories that make up the component"`
+	Responsibilities []string            `json:"responsibilities" description:"What the component is responsible for"`
+	Relations        []ComponentRelation `json:"relations" description:"How the component relates to other components or external systems"`
+}
+
+type ComponentRelation struct {
+	Target      string `json:"target" description:"Name of another component, or of an external system"`
+	Kind        string `json:"kind" enum:"uses,calls,depends_on,implements,extends,configures,produces,consumes"`
+	Description string `json:"description"`
+}
+
+type DescribedEntryPoint struct {
+	Path        string `json:"path" description:"File that defines the entry point"`
+	Kind        string `json:"kind" description:"For example command, server, library, script or container"`
+	Description string `json:"description"`
+}
+
+type TechStackItem struct {
+	Name     string `json:"name"`
+	Version  string `json:"version" description:"Version constraint from the manifest, or empty if unknown"`
+	Category string `json:"category" enum:"language,framework,library,database,tool,service"`
+	Purpose  string `json:"purpose" description:"What the project uses it for"`
+}
+
+// validate checks what the schema cannot express.
+func (d *StructuredDescription) validate() error {
+	var problems []string
+	if strings.TrimSpace(d.Purpose) == "" {
+		problems = append(problems, "purpose is empty")
+	}
+	if len(d.Components) == 0 {
+		problems = append(problems, "components is empty")
+	}
+	seen := make(map[string]bool)
+	for i, c := range d.Components {
+		name := strings.TrimSpace(c.Name)
+		switch {
+		case name == "":
+			problems = append(problems, fmt.Sprintf("components[%d] has no name", i))
+		case seen[name]:
+			problems = append(problems, fmt.Sprintf("component name %q is used more than once", name))
+		}
+		seen[name] = true
+		if len(c.Responsibilities) == 0 {
+			problems = append(problems, fmt.Sprintf("component %q has no responsibilities", name))
+		}
+	}
+	for i, ep := range d.EntryPoints {
+		if strings.TrimSpace(ep.Path) == "" {
+			problems = append(problems, fmt.Sprintf("entry_points[%d] has no path", i))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+var structuredSchema = mustGenerateSchema(StructuredDescription{})
+
+func mustGenerateSchema(v any) *jsonschema.Definition {
+	schema, err := jsonschema.GenerateSchemaForType(v)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// parseStructured validates a reply against the schema and the Go types.
+// Models without native structured output tend to wrap JSON in a Markdown
+// code fence, so one is tolerated.
+func parseStructured(content string) (*StructuredDescription, error) {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(content, "```")
+	}
+
+	// Decoding strictly first gives precise errors for malformed JSON,
+	// wrong types and unknown fields; the schema check reports little more
+	// than pass or fail, but also catches missing fields and enum values.
+	var description StructuredDescription
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&description); err != nil {
+		return nil, err
+	}
+	if err := structuredSchema.Unmarshal(content, &description); err != nil {
+		return nil, fmt.Errorf("reply does not match the JSON schema; check for missing fields and values outside the allowed enums: %w", err)
+	}
+	if err := description.validate(); err != nil {
+		return nil, err
+	}
+	return &description, nil
+}
+
+// completeStructured asks for a StructuredDescription and, when the reply
+// does not validate, sends it back with the error until it does or
+// maxStructuredAttempts is reached.
+func completeStructured(ctx context.Context, completer Completer, prompts *promptSet, stage string, data promptData) (*StructuredDescription, error) {
+	schema, err := json.Marshal(structuredSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= maxStructuredAttempts; attempt++ {
+		req, err := prompts.request(stage, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Schema, req.SchemaName = schema, "project_description"
+		req.Validate = func(content string) error {
+			_, err := parseStructured(content)
+			return err
+		}
+
+		resp, err := completer.Complete(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		description, err := parseStructured(resp.Content)
+		if err == nil {
+			return description, nil
+		}
+
+		lastErr = err
+		progressf("Structured reply %d/%d did not validate: %v\n", attempt, maxStructuredAttempts, err)
+		data.Response, data.ValidationError = resp.Content, err.Error()
+	}
+	return nil, fmt.Errorf("no valid reply after %d attempts: %w", maxStructuredAttempts, lastErr)
+}
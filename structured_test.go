@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const validStructured = `{
+  "name": "demo",
+  "purpose": "Describes repositories.",
+  "components": [
+    {
+      "name": "cli",
+      "paths": ["cli.go"],
+      "responsibilities": ["parse flags"],
+      "relations": [{"target": "pipeline", "kind": "calls", "description": "runs it"}]
+    }
+  ],
+  "entry_points": [{"path": "main.go", "kind": "command", "description": "the binary"}],
+  "tech_stack": [{"name": "Go", "version": "1.22", "category": "language", "purpose": "everything"}]
+}`
+
+func TestParseStructured(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"valid", validStructured, ""},
+		{"fenced", "```json\n" + validStructured + "\n```", ""},
+		{"bare fence", "```\n" + validStructured + "\n```", ""},
+		{"malformed", `{"name": "demo"`, "unexpected EOF"},
+		{"unknown field", strings.Replace(validStructured, `"name": "demo"`, `"name": "demo", "extra": 1`, 1), "unknown field"},
+		{"wrong type", strings.Replace(validStructured, `"paths": ["cli.go"]`, `"paths": "cli.go"`, 1), "cannot unmarshal"},
+		{"bad enum", strings.Replace(validStructured, `"kind": "calls"`, `"kind": "likes"`, 1), "JSON schema"},
+		{"missing field", strings.Replace(validStructured, `"version": "1.22", `, "", 1), "JSON schema"},
+		{"empty purpose", strings.Replace(validStructured, `"Describes repositories."`, `" "`, 1), "purpose is empty"},
+		{"no responsibilities", strings.Replace(validStructured, `["parse flags"]`, `[]`, 1), "has no responsibilities"},
+		{"entry point without path", strings.Replace(validStructured, `"path": "main.go"`, `"path": ""`, 1), "entry_points[0] has no path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			description, err := parseStructured(tt.content)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseStructured: %v", err)
+				}
+				if description.Name != "demo" || len(description.Components) != 1 {
+					t.Errorf("description = %+v", description)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseStructuredDuplicateComponents(t *testing.T) {
+	content := strings.Replace(validStructured, `"components": [`, `"components": [
+    {"name": "cli", "paths": [], "responsibilities": ["more"], "relations": []},`, 1)
+	_, err := parseStructured(content)
+	if err == nil || !strings.Contains(err.Error(), `component name "cli" is used more than once`) {
+		t.Errorf("err = %v, want a duplicate name error", err)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/c"
+	"github.com/smacker/go-tree-sitter/java"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/rust"
+	"github.com/smacker/go-tree-sitter/typescript/tsx"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+)
+
+type Symbol struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"`
+	Line   int    `json:"line"`
+}
+
+// symbolGrammar pairs a tree-sitter grammar with a query whose capture names
+// are symbol kinds. Functions nested in one of the container node types are
+// reported as methods of that container.
+type symbolGrammar struct {
+	language   func() *sitter.Language
+	query      string
+	containers map[string]string
+
+	once     sync.Once
+	compiled *sitter.Query
+	err      error
+}
+
+const pythonSymbolQuery = `
+(class_definition name: (identifier) @class)
+(function_definition name: (identifier) @function)
+(import_statement name: (dotted_name) @import)
+(import_statement name: (aliased_import name: (dotted_name) @import))
+(import_from_statement module_name: (_) @import)
+`
+
+const javascriptSymbolQuery = `
+(class_declaration name: (_) @class)
+(function_declaration name: (identifier) @function)
+(generator_function_declaration name: (identifier) @function)
+(method_definition name: (_) @function)
+(variable_declarator name: (identifier) @function value: [(arrow_function) (function_expression)])
+(import_statement source: (string) @import)
+(call_expression function: (identifier) @_require arguments: (arguments . (string) @import) (#eq? @_require "require"))
+`
+
+const typescriptSymbolQuery = javascriptSymbolQuery + `
+(abstract_class_declaration name: (_) @class)
+(interface_declaration name: (_) @interface)
+(type_alias_declaration name: (_) @type)
+(enum_declaration name: (_) @enum)
+(internal_module name: (_) @module)
+`
+
+const rustSymbolQuery = `
+(mod_item name: (identifier) @module)
+(struct_item name: (type_identifier) @struct)
+(enum_item name: (type_identifier) @enum)
+(trait_item name: (type_identifier) @trait)
+(type_item name: (type_identifier) @type)
+(function_item name: (identifier) @function)
+(function_signature_item name: (identifier) @function)
+(use_declaration argument: (_) @import)
+(extern_crate_declaration name: (identifier) @import)
+`
+
+const javaSymbolQuery = `
+(package_declaration (_) @module)
+(class_declaration name: (identifier) @class)
+(interface_declaration name: (identifier) @interface)
+(enum_declaration name: (identifier) @enum)
+(method_declaration name: (identifier) @function)
+(constructor_declaration name: (identifier) @function)
+(import_declaration (_) @import)
+`
+
+const cSymbolQuery = `
+(function_definition declarator: (function_declarator declarator: (identifier) @function))
+(function_definition declarator: (pointer_declarator declarator: (function_declarator declarator: (identifier) @function)))
+(declaration declarator: (function_declarator declarator: (identifier) @function))
+(struct_specifier name: (type_identifier) @struct body: (_))
+(union_specifier name: (type_identifier) @struct body: (_))
+(enum_specifier name: (type_identifier) @enum body: (_))
+(type_definition declarator: (type_identifier) @type)
+(preproc_include path: (_) @import)
+`
+
+var (
+	pythonGrammar = &symbolGrammar{
+		language:   python.GetLanguage,
+		query:      pythonSymbolQuery,
+		containers: map[string]string{"class_definition": "name"},
+	}
+	javascriptGrammar = &symbolGrammar{
+		language:   javascript.GetLanguage,
+		query:      javascriptSymbolQuery,
+		containers: map[string]string{"class_declaration": "name", "class": "name"},
+	}
+	typescriptGrammar = &symbolGrammar{
+		language:   typescript.GetLanguage,
+		query:      typescriptSymbolQuery,
+		containers: map[string]string{"class_declaration": "name", "abstract_class_declaration": "name", "class": "name"},
+	}
+	tsxGrammar = &symbolGrammar{
+		language:   tsx.GetLanguage,
+		query:      typescriptSymbolQuery,
+		containers: typescriptGrammar.containers,
+	}
+	rustGrammar = &symbolGrammar{
+		language:   rust.GetLanguage,
+		query:      rustSymbolQuery,
+		containers: map[string]string{"impl_item": "type", "trait_item": "name"},
+	}
+	javaGrammar = &symbolGrammar{
+		language:   java.GetLanguage,
+		query:      javaSymbolQuery,
+		containers: map[string]string{"class_declaration": "name", "interface_declaration": "name", "enum_declaration": "name"},
+	}
+	cGrammar = &symbolGrammar{
+		language: c.GetLanguage,
+		query:    cSymbolQuery,
+	}
+)
+
+var symbolGrammars = map[string]*symbolGrammar{
+	".py":   pythonGrammar,
+	".pyi":  pythonGrammar,
+	".js":   javascriptGrammar,
+	".jsx":  javascriptGrammar,
+	".mjs":  javascriptGrammar,
+	".cjs":  javascriptGrammar,
+	".ts":   typescriptGrammar,
+	".mts":  typescriptGrammar,
+	".tsx":  tsxGrammar,
+	".rs":   rustGrammar,
+	".java": javaGrammar,
+	".c":    cGrammar,
+	".h":    cGrammar,
+}
+
+func (g *symbolGrammar) compile() (*sitter.Query, error) {
+	g.once.Do(func() {
+		g.compiled, g.err = sitter.NewQuery([]byte(g.query), g.language())
+	})
+	return g.compiled, g.err
+}
+
+// extractSymbols parses every file in a supported language with tree-sitter
+// and lists its modules, types, functions and imports. Files in other
+// languages are left out.
+func extractSymbols(code map[string]string) (map[string][]Symbol, error) {
+	symbols := make(map[string][]Symbol)
+	for _, file := range sortedKeys(code) {
+		grammar, ok := symbolGrammars[strings.ToLower(filepath.Ext(file))]
+		if !ok || vendoredPath.MatchString(filepath.ToSlash(file)) {
+			continue
+		}
+		query, err := grammar.compile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %s symbol query: %w", filepath.Ext(file), err)
+		}
+
+		fileSymbols, err := grammar.extract(query, []byte(code[file]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if grammar == pythonGrammar {
+			fileSymbols = append([]Symbol{{Kind: "module", Name: pythonModuleName(file), Line: 1}}, fileSymbols...)
+		}
+		if len(fileSymbols) > 0 {
+			symbols[filepath.ToSlash(file)] = fileSymbols
+		}
+	}
+	return symbols, nil
+}
+
+func (g *symbolGrammar) extract(query *sitter.Query, source []byte) ([]Symbol, error) {
+	parser := sitter.NewParser()
+	defer parser.Close()
+	parser.SetLanguage(g.language())
+
+	tree, err := parser.ParseCtx(context.Background(), nil, source)
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Close()
+
+	cursor := sitter.NewQueryCursor()
+	defer cursor.Close()
+	cursor.Exec(query, tree.RootNode())
+
+	var symbols []Symbol
+	seen := make(map[Symbol]bool)
+	for {
+		match, ok := cursor.NextMatch()
+		if !ok {
+			break
+		}
+		match = cursor.FilterPredicates(match, source)
+		for _, capture := range match.Captures {
+			kind := query.CaptureNameForId(capture.Index)
+			if strings.HasPrefix(kind, "_") {
+				continue
+			}
+			symbol := Symbol{
+				Kind: kind,
+				Name: strings.Trim(capture.Node.Content(source), "\"'`<>"),
+				Line: int(capture.Node.StartPoint().Row) + 1,
+			}
+			if kind == "function" {
+				if parent := g.container(capture.Node, source); parent != "" {
+					symbol.Kind, symbol.Parent = "method", parent
+				}
+			}
+			if !seen[symbol] {
+				seen[symbol] = true
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// container returns the name of the class, impl or similar block that
+// encloses node, skipping the definition node itself.
+func (g *symbolGrammar) container(node *sitter.Node, source []byte) string {
+	for n := node.Parent(); n != nil; n = n.Parent() {
+		field, ok := g.containers[n.Type()]
+		if !ok {
+			continue
+		}
+		if name := n.ChildByFieldName(field); name != nil {
+			return name.Content(source)
+		}
+		return ""
+	}
+	return ""
+}
+
+func pythonModuleName(file string) string {
+	module := strings.TrimSuffix(filepath.ToSlash(file), path.Ext(file))
+	module = strings.TrimSuffix(module, "/__init__")
+	return strings.ReplaceAll(module, "/", ".")
+}
+
+// formatSymbols renders symbols compactly for prompts, one line per file,
+// stopping once maxTokens is reached.
+func formatSymbols(symbols map[string][]Symbol, maxTokens int) string {
+	files := sortedKeys(symbols)
+
+	var lines []string
+	used := 0
+	for i, file := range files {
+		var parts []string
+		for _, s := range symbols[file] {
+			name := s.Name
+			if s.Parent != "" {
+				name = s.Parent + "." + name
+			}
+			parts = append(parts, s.Kind+" "+name)
+		}
+		line := file + ": " + strings.Join(parts, ", ")
+		used += estimateTokens(line)
+		if used > maxTokens {
+			lines = append(lines, fmt.Sprintf("... symbols for %d more files omitted", len(files)-i))
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
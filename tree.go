@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const summaryFileName = "SUMMARY.md"
+
+// dirNode is one directory of the repository. Paths are slash separated and
+// relative to the repository root, which is ".".
+type dirNode struct {
+	Path     string
+	Files    []string
+	Children []*dirNode
+	Summary  string
+}
+
+func (n *dirNode) name() string {
+	if n.Path == "." {
+		return "."
+	}
+	return path.Base(n.Path) + "/"
+}
+
+func buildDirTree(fileStructure []string) *dirNode {
+	root := &dirNode{Path: "."}
+	nodes := map[string]*dirNode{".": root}
+
+	var ensure func(dir string) *dirNode
+	ensure = func(dir string) *dirNode {
+		if node, ok := nodes[dir]; ok {
+			return node
+		}
+		node := &dirNode{Path: dir}
+		nodes[dir] = node
+		parent := ensure(path.Dir(dir))
+		parent.Children = append(parent.Children, node)
+		return node
+	}
+
+	for _, file := range fileStructure {
+		file = filepath.ToSlash(file)
+		node := ensure(path.Dir(file))
+		node.Files = append(node.Files, file)
+	}
+
+	for _, node := range nodes {
+		sort.Strings(node.Files)
+		sort.Slice(node.Children, func(i, j int) bool {
+			return node.Children[i].Path < node.Children[j].Path
+		})
+	}
+	return root
+}
+
+func renderChildSummaries(children []*dirNode) []string {
+	var blocks []string
+	for _, child := range children {
+		blocks = append(blocks, fmt.Sprintf("Subdirectory %s summary:\n%s\n\n", child.Path+"/", child.Summary))
+	}
+	return blocks
+}
+
+// summarizeTree fills in Summary for every directory bottom-up, so a
+// directory's prompt only ever contains its own files and the summaries of its
+// subdirectories, plus any structural summary in packages for the directory.
+// Files that do not fit in budget are summarized in chunks first, the same
+// way summarizeCode handles a whole repository. Sibling directories are
+// summarized concurrently.
+func (p *pipeline) summarizeTree(ctx context.Context, projectName string, node *dirNode, code, packages map[string]string) error {
+	err := forEach(ctx, p.concurrency, len(node.Children), func(ctx context.Context, i int) error {
+		return p.summarizeTree(ctx, projectName, node.Children[i], code, packages)
+	})
+	if err != nil {
+		return err
+	}
+
+	progressf("Summarizing directory %s\n", node.Path)
+
+	label := node.Path
+	if label == "." {
+		label = "root"
+	}
+
+	files := make(map[string]string)
+	var blocks []string
+	if summary, ok := packages[node.Path]; ok {
+		files["package summary"] = summary
+		blocks = append(blocks, renderFile("package summary", summary))
+	}
+	for _, file := range node.Files {
+		content, ok := code[filepath.FromSlash(file)]
+		if !ok {
+			continue
+		}
+		files[file] = content
+		blocks = append(blocks, renderFile(file, content))
+	}
+	children := renderChildSummaries(node.Children)
+
+	data := promptData{ProjectName: projectName, Directory: label, Code: strings.Join(append(blocks, children...), "")}
+	if p.prompts.tokens(stageDirectory, data) > p.tokenBudget {
+		chunkData := func(chunk string) promptData { return promptData{ProjectName: projectName, Code: chunk} }
+		fileSummaries, err := p.summarizeChunks(ctx, stageChunk, chunkData, files)
+		if err != nil {
+			return fmt.Errorf("directory %s: %w", node.Path, err)
+		}
+		for i, summary := range fileSummaries {
+			fileSummaries[i] = fmt.Sprintf("File summary:\n%s\n\n", summary)
+		}
+
+		target := p.tokenBudget - p.prompts.tokens(stageDirectory, promptData{ProjectName: projectName, Directory: label})
+		parts, err := p.mergeSummaries(ctx, projectName, append(fileSummaries, children...), target)
+		if err != nil {
+			return fmt.Errorf("directory %s: %w", node.Path, err)
+		}
+		data.Code = strings.Join(parts, "")
+	}
+
+	summary, err := complete(ctx, p.completer, p.prompts, stageDirectory, data)
+	if err != nil {
+		return fmt.Errorf("directory %s: %w", node.Path, err)
+	}
+	node.Summary = summary
+	return nil
+}
+
+// writeSummaryTree mirrors the repository layout under dir with one
+// SUMMARY.md per directory, each linking to its subdirectories' summaries.
+func writeSummaryTree(node *dirNode, dir string) error {
+	nodeDir := filepath.Join(dir, filepath.FromSlash(node.Path))
+	if err := os.MkdirAll(nodeDir, 0755); err != nil {
+		return err
+	}
+
+	summary := strings.TrimSpace(node.Summary)
+	if summary == "" {
+		// The run was stopped before this directory was summarized.
+		summary = "_Not summarized._"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n%s\n", node.name(), summary)
+	if len(node.Children) > 0 {
+		b.WriteString("\n## Subdirectories\n\n")
+		for _, child := range node.Children {
+			fmt.Fprintf(&b, "- [%s](%s/%s)\n", child.name(), path.Base(child.Path), summaryFileName)
+		}
+	}
+	if node.Path != "." {
+		fmt.Fprintf(&b, "\n[Up](../%s)\n", summaryFileName)
+	}
+
+	if err := writeFile(filepath.Join(nodeDir, summaryFileName), []byte(b.String())); err != nil {
+		return err
+	}
+	for _, child := range node.Children {
+		if err := writeSummaryTree(child, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
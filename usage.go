@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errOverBudget stops a run that would go over -max-tokens or -max-cost.
+var errOverBudget = errors.New("over budget")
+
+// modelPrice is what a model costs in US dollars per million tokens.
+type modelPrice struct {
+	Input  float64 `json:"input_per_million"`
+	Output float64 `json:"output_per_million"`
+}
+
+// modelPrices are list prices, keyed by model name prefix; the longest
+// matching prefix wins, so dated snapshots can differ from their alias.
+// input_price and output_price override them.
+var modelPrices = map[string]modelPrice{
+	"gpt-4o":            {Input: 2.50, Output: 10.00},
+	"gpt-4o-2024-05-13": {Input: 5.00, Output: 15.00},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.60},
+	"gpt-4.1":           {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini":      {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":      {Input: 0.10, Output: 0.40},
+	"gpt-4-turbo":       {Input: 10.00, Output: 30.00},
+	"gpt-3.5-turbo":     {Input: 0.50, Output: 1.50},
+	"o1":                {Input: 15.00, Output: 60.00},
+	"o1-mini":           {Input: 1.10, Output: 4.40},
+	"o3-mini":           {Input: 1.10, Output: 4.40},
+	"claude-3-5-sonnet": {Input: 3.00, Output: 15.00},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4.00},
+	"claude-3-7-sonnet": {Input: 3.00, Output: 15.00},
+	"claude-3-opus":     {Input: 15.00, Output: 75.00},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25},
+	"claude-sonnet-4":   {Input: 3.00, Output: 15.00},
+	"claude-opus-4":     {Input: 15.00, Output: 75.00},
+}
+
+// lookupPrice finds the price of model, reporting whether one is known.
+// Local providers cost nothing.
+func lookupPrice(providerName, model string) (modelPrice, bool) {
+	if providers[providerName].local {
+		return modelPrice{}, true
+	}
+	best := ""
+	for name := range modelPrices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return modelPrices[best], true
+}
+
+func (p modelPrice) cost(u Usage) float64 {
+	return (float64(u.PromptTokens)*p.Input + float64(u.CompletionTokens)*p.Output) / 1e6
+}
+
+// callUsage is one model call in usage.json.
+type callUsage struct {
+	Stage string `json:"stage"`
+	Usage
+	// Estimated is set when the provider did not report usage and the
+	// tokens were estimated from the text instead.
+	Estimated bool     `json:"estimated,omitempty"`
+	Cost      *float64 `json:"cost_usd,omitempty"`
+}
+
+// usageTotal adds up calls.
+type usageTotal struct {
+	Calls int `json:"calls"`
+	Usage
+	Cost *float64 `json:"cost_usd,omitempty"`
+}
+
+func (t *usageTotal) add(call callUsage) {
+	t.Calls++
+	t.PromptTokens += call.PromptTokens
+	t.CompletionTokens += call.CompletionTokens
+	if call.Cost != nil {
+		cost := *call.Cost
+		if t.Cost != nil {
+			cost += *t.Cost
+		}
+		t.Cost = &cost
+	}
+}
+
+// usageBudget limits a run. Zero limits mean unlimited.
+type usageBudget struct {
+	maxTokens int
+	maxCost   float64
+}
+
+// meteredCompleter records the tokens every call uses and refuses calls that
+// could take the run over its budget. It sits below the response cache, so
+// cache hits are free, and above the retry layer, so a call counts once
+// however many attempts it took.
+type meteredCompleter struct {
+	next     Completer
+	provider string
+	model    string
+	price    modelPrice
+	priced   bool
+	budget   usageBudget
+	// dryRun marks the usage as projected rather than spent.
+	dryRun bool
+
+	mu    sync.Mutex
+	calls []callUsage
+	total usageTotal
+	// reserved is the estimated prompt tokens of the calls in flight, which
+	// count against the budget until their usage is known.
+	reserved int
+}
+
+func newMeteredCompleter(next Completer, cfg ProviderConfig, price modelPrice, priced bool, budget usageBudget) *meteredCompleter {
+	return &meteredCompleter{next: next, provider: cfg.Name, model: cfg.Model, price: price, priced: priced, budget: budget}
+}
+
+func (m *meteredCompleter) Complete(ctx context.Context, req CompletionRequest) (Completion, error) {
+	estimate := estimateTokens(req.System) + estimateTokens(req.Prompt)
+	if err := m.reserve(estimate); err != nil {
+		return Completion{}, err
+	}
+	resp, err := m.next.Complete(ctx, req)
+	m.record(req, estimate, resp, err)
+	return resp, err
+}
+
+// reserve checks that a prompt of about tokens still fits in the budget,
+// counting only what is known before the reply: the usage so far, the
+// prompts in flight and this prompt.
+func (m *meteredCompleter) reserve(tokens int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	projected := m.total.PromptTokens + m.total.CompletionTokens + m.reserved + tokens
+	if m.budget.maxTokens > 0 && projected > m.budget.maxTokens {
+		return fmt.Errorf("%w: the next call would bring the run to about %d tokens, over the limit of %d", errOverBudget, projected, m.budget.maxTokens)
+	}
+	if m.budget.maxCost > 0 {
+		spent := 0.0
+		if m.total.Cost != nil {
+			spent = *m.total.Cost
+		}
+		projectedCost := spent + m.price.cost(Usage{PromptTokens: m.reserved + tokens})
+		if projectedCost > m.budget.maxCost {
+			return fmt.Errorf("%w: the next call would bring the run to about $%.4f, over the limit of $%g", errOverBudget, projectedCost, m.budget.maxCost)
+		}
+	}
+	m.reserved += tokens
+	return nil
+}
+
+func (m *meteredCompleter) record(req CompletionRequest, estimate int, resp Completion, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reserved -= estimate
+	if err != nil {
+		return
+	}
+	call := callUsage{Stage: req.Stage, Usage: resp.Usage}
+	if call.Usage == (Usage{}) {
+		call.Usage = Usage{PromptTokens: estimate, CompletionTokens: estimateTokens(resp.Content)}
+		call.Estimated = true
+	}
+	if m.priced {
+		cost := m.price.cost(call.Usage)
+		call.Cost = &cost
+	}
+	m.calls = append(m.calls, call)
+	m.total.add(call)
+}
+
+// usageReport is usage.json.
+type usageReport struct {
+	DryRun   bool                  `json:"dry_run,omitempty"`
+	Provider string                `json:"provider"`
+	Model    string                `json:"model"`
+	Price    *modelPrice           `json:"price,omitempty"`
+	Total    usageTotal            `json:"total"`
+	ByStage  map[string]usageTotal `json:"by_stage"`
+	Calls    []callUsage           `json:"calls"`
+}
+
+func (m *meteredCompleter) report() usageReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := usageReport{
+		DryRun:   m.dryRun,
+		Provider: m.provider,
+		Model:    m.model,
+		Total:    m.total,
+		ByStage:  make(map[string]usageTotal),
+		Calls:    append([]callUsage{}, m.calls...),
+	}
+	if m.priced {
+		price := m.price
+		r.Price = &price
+	}
+	for _, call := range m.calls {
+		total := r.ByStage[call.Stage]
+		total.add(call)
+		r.ByStage[call.Stage] = total
+	}
+	// Group the calls by stage; within one, they are in the order they
+	// finished.
+	sort.SliceStable(r.Calls, func(i, j int) bool { return r.Calls[i].Stage < r.Calls[j].Stage })
+	return r
+}
+
+// summary is the usage line printed at the end of a run.
+func (r usageReport) summary() string {
+	if r.DryRun {
+		s := fmt.Sprintf("Dry run: %d prompts to send, about %d tokens", r.Total.Calls, r.Total.PromptTokens)
+		switch {
+		case r.Total.Cost != nil:
+			s += fmt.Sprintf(", projected to cost about $%.4f before the replies", *r.Total.Cost)
+		case r.Price == nil && r.Total.Calls > 0:
+			s += fmt.Sprintf("; no price is known for %s, set input_price and output_price to project the cost", r.Model)
+		}
+		return s
+	}
+	s := fmt.Sprintf("Usage: %d calls, %d prompt and %d completion tokens", r.Total.Calls, r.Total.PromptTokens, r.Total.CompletionTokens)
+	switch {
+	case r.Total.Cost != nil:
+		s += fmt.Sprintf(", about $%.4f", *r.Total.Cost)
+	case r.Price == nil && r.Total.Calls > 0:
+		s += fmt.Sprintf("; no price is known for %s, set input_price and output_price to estimate the cost", r.Model)
+	}
+	return s
+}
+
+func writeUsageReport(outputDir string, r usageReport) (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	path := filepath.Join(outputDir, "usage.json")
+	if err := writeFile(path, data); err != nil {
+		return "", fmt.Errorf("failed to write usage report: %w", err)
+	}
+	return path, nil
+}